@@ -176,6 +176,8 @@ async function uploadVideoFile(videoID) {
     }
 
     console.log('Video uploaded!');
+    document.getElementById(uploadBtnSelector).textContent = 'Processing...';
+    await waitForVideoProcessing(videoID);
     await getVideo(videoID);
   } catch (error) {
     alert(`Error: ${error.message}`);
@@ -184,11 +186,42 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+const processingPollInterval = 2000;
+
+// Uploads are processed in the background, so poll until the job is done.
+async function waitForVideoProcessing(videoID) {
+  for (;;) {
+    const res = await fetch(`/api/videos/${videoID}/status`, {
+      method: 'GET',
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to get processing status. Error: ${data.error}`);
+    }
+
+    const status = await res.json();
+    if (!status.status || status.status === 'ready') {
+      return;
+    }
+    if (status.status === 'failed') {
+      throw new Error(`Video processing failed: ${status.error}`);
+    }
+    await new Promise((resolve) => setTimeout(resolve, processingPollInterval));
+  }
+}
+
 const videoStateHandler = createVideoStateHandler();
 
-async function getVideos() {
+async function getVideos(cursor) {
   try {
-    const res = await fetch('/api/videos', {
+    const params = new URLSearchParams();
+    if (cursor) {
+      params.set('cursor', cursor);
+    }
+    const res = await fetch(`/api/videos?${params}`, {
       method: 'GET',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -199,15 +232,25 @@ async function getVideos() {
       throw new Error(`Failed to get videos. Error: ${data.error}`);
     }
 
-    const videos = await res.json();
+    const page = await res.json();
     const videoList = document.getElementById('video-list');
-    videoList.innerHTML = '';
-    for (const video of videos) {
+    if (!cursor) {
+      videoList.innerHTML = '';
+    }
+    videoList.querySelector('.load-more')?.remove();
+    for (const video of page.videos) {
       const listItem = document.createElement('li');
       listItem.textContent = video.title;
       listItem.onclick = () => videoStateHandler(video.id);
       videoList.appendChild(listItem);
     }
+    if (page.next_cursor) {
+      const loadMore = document.createElement('li');
+      loadMore.className = 'load-more';
+      loadMore.textContent = `Load more (${videoList.children.length} of ${page.total_count})`;
+      loadMore.onclick = () => getVideos(page.next_cursor);
+      videoList.appendChild(loadMore);
+    }
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
@@ -292,7 +335,7 @@ async function deleteVideo() {
     if (!res.ok) {
       throw new Error('Failed to delete video.');
     }
-    alert('Video deleted successfully.');
+    alert('Video moved to the trash.');
     document.getElementById('video-display').style.display = 'none';
     await getVideos();
   } catch (error) {
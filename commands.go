@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+// runCommand runs a one-off maintenance command instead of the server, e.g.
+// `go run . migrate-thumbnails`.
+func (cfg *apiConfig) runCommand(name string, args []string) error {
+	switch name {
+	case "migrate-thumbnails":
+		return cfg.migrateThumbnails(args)
+	case "gc":
+		return cfg.garbageCollect(args)
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
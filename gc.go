@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+const defaultGCGracePeriod = 24 * time.Hour
+
+type gcOptions struct {
+	// Objects younger than gracePeriod are never orphans; they may belong
+	// to a video that is still being processed.
+	gracePeriod time.Duration
+	delete      bool
+}
+
+type gcReport struct {
+	scanned      int
+	unmapped     int
+	orphans      int
+	orphanBytes  int64
+	deleted      int
+	deleteErrors int
+}
+
+// storageReferences holds the keys the database still points at. Objects
+// under a prefix, such as HLS segments, are referenced through their
+// manifest's base key. unmapped counts stored URLs that don't map to a key,
+// e.g. ones written under a different S3_CF_DISTRO; the objects behind them
+// would look like orphans.
+type storageReferences struct {
+	keys     map[string]bool
+	prefixes []string
+	unmapped int
+}
+
+func (refs storageReferences) contains(key string) bool {
+	if refs.keys[key] {
+		return true
+	}
+	for _, prefix := range refs.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (refs *storageReferences) addVideo(cfg *apiConfig, video database.Video) {
+	rewriteVideoURLs(video, func(stored string) (string, error) {
+		if key, ok := cfg.objectKey(stored); ok {
+			refs.keys[key] = true
+		} else if !isAssetURL(stored) {
+			refs.unmapped++
+			log.Printf("Video %s references %s, which isn't in storage", video.ID, stored)
+		}
+		return stored, nil
+	})
+	if video.VideoURL != nil {
+		if videoKey, ok := cfg.objectKey(*video.VideoURL); ok {
+			refs.prefixes = append(refs.prefixes, strings.TrimSuffix(videoKey, ".mp4")+"/")
+		}
+	}
+}
+
+func (cfg *apiConfig) storageReferences() (storageReferences, error) {
+	refs := storageReferences{keys: map[string]bool{}}
+
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return storageReferences{}, err
+	}
+	for _, video := range videos {
+		refs.addVideo(cfg, video)
+	}
+
+	// Previous versions stay referenced until they fall out of retention.
+	versions, err := cfg.db.GetAllVideoVersions()
+	if err != nil {
+		return storageReferences{}, err
+	}
+	for _, version := range versions {
+		refs.addVideo(cfg, version.Apply(database.Video{}))
+	}
+
+	rawKeys, err := cfg.db.GetPendingRawKeys()
+	if err != nil {
+		return storageReferences{}, err
+	}
+	for _, key := range rawKeys {
+		refs.keys[key] = true
+	}
+	return refs, nil
+}
+
+// gcPrefixes are the storage prefixes tubely writes to.
+func gcPrefixes() []string {
+	prefixes := []string{"thumbnails/", "raw/", privateKeyPrefix, otherAspectRatioPrefix}
+	for _, bucket := range aspectRatioBuckets {
+		prefixes = append(prefixes, bucket.prefix)
+	}
+	return prefixes
+}
+
+// collectGarbage finds stored objects no video references and, if
+// opts.delete is set, deletes them.
+func (cfg *apiConfig) collectGarbage(ctx context.Context, opts gcOptions) (gcReport, error) {
+	report := gcReport{}
+	cutoff := time.Now().Add(-opts.gracePeriod)
+
+	// Objects are listed before references are loaded so anything written
+	// in between is either referenced or inside the grace period.
+	candidates := []storage.ObjectInfo{}
+	for _, prefix := range gcPrefixes() {
+		infos, err := cfg.storage.List(ctx, prefix)
+		if err != nil {
+			return report, err
+		}
+		report.scanned += len(infos)
+		for _, info := range infos {
+			if info.LastModified.After(cutoff) {
+				continue
+			}
+			candidates = append(candidates, info)
+		}
+	}
+
+	refs, err := cfg.storageReferences()
+	if err != nil {
+		return report, err
+	}
+	report.unmapped = refs.unmapped
+	if opts.delete && refs.unmapped > 0 {
+		return report, fmt.Errorf("refusing to delete: %d stored URLs don't map to storage keys", refs.unmapped)
+	}
+
+	for _, object := range candidates {
+		if refs.contains(object.Key) {
+			continue
+		}
+		report.orphans++
+		report.orphanBytes += object.Size
+		if !opts.delete {
+			log.Printf("Orphan: %s (%d bytes, modified %s)", object.Key, object.Size, object.LastModified.Format(time.RFC3339))
+			continue
+		}
+		err := cfg.storage.Delete(ctx, object.Key)
+		if err != nil {
+			report.deleteErrors++
+			log.Printf("Couldn't delete orphan %s: %v", object.Key, err)
+			continue
+		}
+		report.deleted++
+		log.Printf("Deleted orphan: %s (%d bytes)", object.Key, object.Size)
+	}
+	return report, nil
+}
+
+func (report gcReport) log() {
+	log.Printf("Scanned %d objects, found %d orphans (%d bytes), deleted %d, %d failed, %d unmapped references",
+		report.scanned, report.orphans, report.orphanBytes, report.deleted, report.deleteErrors, report.unmapped)
+}
+
+// garbageCollect reports orphaned storage objects, e.g.
+// `go run . gc -grace 48h`. Nothing is deleted without -delete.
+func (cfg *apiConfig) garbageCollect(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	deleteOrphans := flags.Bool("delete", false, "delete the orphans instead of only reporting them")
+	gracePeriod := flags.Duration("grace", defaultGCGracePeriod, "ignore objects modified more recently than this")
+	flags.Parse(args)
+
+	report, err := cfg.collectGarbage(context.Background(), gcOptions{
+		gracePeriod: *gracePeriod,
+		delete:      *deleteOrphans,
+	})
+	if err != nil {
+		return err
+	}
+	report.log()
+	return nil
+}
+
+func (cfg *apiConfig) runGarbageCollector(ctx context.Context, interval time.Duration, opts gcOptions) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		report, err := cfg.collectGarbage(ctx, opts)
+		if err != nil {
+			log.Printf("Garbage collection failed: %v", err)
+			continue
+		}
+		report.log()
+	}
+}
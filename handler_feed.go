@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type videoPage struct {
+	Videos     []database.Video `json:"videos"`
+	NextCursor *string          `json:"next_cursor"`
+	TotalCount int              `json:"total_count"`
+}
+
+// parsePageLimit reads the limit query parameter, defaulting to
+// defaultPageLimit.
+func parsePageLimit(r *http.Request) (int, error) {
+	limitParam := r.URL.Query().Get("limit")
+	if limitParam == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	return limit, nil
+}
+
+// handlerFeed lists playable public videos for anyone, including
+// anonymous visitors.
+func (cfg *apiConfig) handlerFeed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := database.ListVideosParams{
+		Public: true,
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+	if params.Sort == "" {
+		params.Sort = database.VideoSortNewest
+	}
+	if params.Sort != database.VideoSortNewest && params.Sort != database.VideoSortMostViewed {
+		respondWithError(w, http.StatusBadRequest, "sort must be 'newest' or 'most_viewed'", nil)
+		return
+	}
+	if uploader := query.Get("uploader"); uploader != "" {
+		uploaderID, err := uuid.Parse(uploader)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid uploader ID", err)
+			return
+		}
+		params.UserID = uploaderID
+	}
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	params.Limit = limit
+
+	cfg.respondWithVideoPage(w, r, params)
+}
+
+func (cfg *apiConfig) respondWithVideoPage(w http.ResponseWriter, r *http.Request, params database.ListVideosParams) {
+	videos, nextCursor, err := cfg.db.ListVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	totalCount, err := cfg.db.CountVideos(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count videos", err)
+		return
+	}
+
+	page := videoPage{Videos: videos, TotalCount: totalCount}
+	if nextCursor != "" {
+		page.NextCursor = &nextCursor
+	}
+	for i := range page.Videos {
+		page.Videos[i], err = cfg.videoForResponse(r, page.Videos[i])
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+			return
+		}
+	}
+	respondWithJSON(w, http.StatusOK, page)
+}
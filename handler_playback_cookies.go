@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// handlerVideoPlaybackCookies sets CloudFront signed cookies covering every
+// object of the video. HLS and DASH players fetch playlists and segments by
+// relative URL, which a signed manifest URL alone doesn't authorize.
+func (cfg *apiConfig) handlerVideoPlaybackCookies(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	if cfg.cdnSigner == nil {
+		respondWithError(w, http.StatusNotImplemented, "Signed cookies require a CloudFront key pair", nil)
+		return
+	}
+
+	userID, err := cfg.requestUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	canView, err := cfg.canViewVideo(video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if video.ID == uuid.Nil || !canView {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusConflict, "Video hasn't been processed yet", nil)
+		return
+	}
+	videoKey, ok := cfg.objectKey(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Video isn't served from object storage", nil)
+		return
+	}
+
+	// Renditions, sprites and manifests all live under the MP4's key without
+	// its extension, so one wildcard covers them.
+	baseKey := strings.TrimSuffix(videoKey, ".mp4")
+	expires := time.Now().Add(cfg.playbackCookieExpiry)
+	cookies, err := cfg.cdnSigner.Cookies(cfg.cdnPolicy(r, cfg.objectURL(baseKey)+"*", expires))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign cookies", err)
+		return
+	}
+	for _, cookie := range cookies {
+		cookie.Domain = cfg.cdnCookieDomain
+		http.SetCookie(w, cookie)
+	}
+	respondWithJSON(w, http.StatusOK, response{ExpiresAt: expires})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+type searchPage struct {
+	Results    []database.SearchResult `json:"results"`
+	NextCursor *string                 `json:"next_cursor"`
+	TotalCount int                     `json:"total_count"`
+}
+
+// handlerSearch searches public videos by title and description, along with
+// the caller's own videos when the request is authenticated.
+func (cfg *apiConfig) handlerSearch(w http.ResponseWriter, r *http.Request) {
+	if !cfg.db.SearchEnabled() {
+		respondWithError(w, http.StatusNotImplemented, "Search requires SQLite with FTS5 (build with -tags sqlite_fts5)", nil)
+		return
+	}
+
+	userID, err := cfg.requestUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.SearchVideosParams{
+		Query:  query.Get("q"),
+		UserID: userID,
+		Cursor: query.Get("cursor"),
+	}
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	params.Limit = limit
+
+	results, nextCursor, err := cfg.db.SearchVideos(params)
+	if errors.Is(err, database.ErrInvalidSearchQuery) {
+		respondWithError(w, http.StatusBadRequest, "q must contain at least one word", err)
+		return
+	}
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	totalCount, err := cfg.db.CountSearchResults(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count search results", err)
+		return
+	}
+
+	page := searchPage{Results: results, TotalCount: totalCount}
+	if nextCursor != "" {
+		page.NextCursor = &nextCursor
+	}
+	for i := range page.Results {
+		page.Results[i].Video, err = cfg.videoForResponse(r, page.Results[i].Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+			return
+		}
+	}
+	respondWithJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	trashPurgeInterval  = time.Hour
+	trashPurgeBatchSize = 100
+)
+
+// handlerTrashGet lists the caller's deleted videos, most recently deleted
+// first.
+func (cfg *apiConfig) handlerTrashGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	cfg.respondWithVideoPage(w, r, database.ListVideosParams{
+		UserID:  userID,
+		Trashed: true,
+		Sort:    database.VideoSortDeleted,
+		Cursor:  r.URL.Query().Get("cursor"),
+		Limit:   limit,
+	})
+}
+
+func (cfg *apiConfig) handlerTrashRestore(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideoIncludingTrashed(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video data", err)
+		return
+	}
+	if video.UserID != userID || video.DeletedAt == nil {
+		respondWithError(w, http.StatusNotFound, "Video isn't in the trash", nil)
+		return
+	}
+
+	quota, usage, err := cfg.userQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve quota", err)
+		return
+	}
+	if usage.Videos >= quota.MaxVideos {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Your plan is limited to %d videos", quota.MaxVideos), nil)
+		return
+	}
+
+	err = cfg.db.RestoreVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video data", err)
+		return
+	}
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
+}
+
+// purgeVideo permanently deletes a video that was trashed before cutoff,
+// its versions and their stored objects. The chunks of its upload sessions
+// are left to the upload session sweeper.
+func (cfg *apiConfig) purgeVideo(ctx context.Context, videoID uuid.UUID, cutoff time.Time) error {
+	video, err := cfg.db.GetVideoIncludingTrashed(videoID)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve video: %w", err)
+	}
+	versions, err := cfg.db.GetVideoVersions(videoID)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve video versions: %w", err)
+	}
+	deleted, err := cfg.db.DeleteTrashedVideo(videoID, cutoff)
+	if err != nil {
+		return fmt.Errorf("couldn't delete video: %w", err)
+	}
+	if !deleted {
+		// Restored since it was listed.
+		return nil
+	}
+	cfg.deleteVideoStorage(ctx, video, versions)
+	return nil
+}
+
+// runTrashPurger permanently deletes videos that have been in the trash for
+// longer than trashRetention.
+func (cfg *apiConfig) runTrashPurger(ctx context.Context) {
+	for {
+		cutoff := time.Now().Add(-cfg.trashRetention)
+		videos, err := cfg.db.GetVideosTrashedBefore(cutoff, trashPurgeBatchSize)
+		if err != nil {
+			log.Printf("Couldn't retrieve expired trash: %v", err)
+		}
+		for _, video := range videos {
+			err := cfg.purgeVideo(ctx, video.ID, cutoff)
+			if err != nil {
+				log.Printf("Couldn't purge video %s: %v", video.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(trashPurgeInterval):
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxSessionUploadSize = 10 << 30 // 10 GB
+	defaultChunkSize     = 8 << 20  // 8 MB
+	minChunkSize         = 1 << 20  // 1 MB
+	maxChunkSize         = 64 << 20 // 64 MB
+
+	uploadSessionSweepInterval  = time.Hour
+	uploadSessionSweepBatchSize = 100
+)
+
+type uploadSessionResponse struct {
+	database.UploadSession
+	ChunkCount    int   `json:"chunk_count"`
+	MissingChunks []int `json:"missing_chunks"`
+}
+
+func newUploadSessionResponse(session database.UploadSession) uploadSessionResponse {
+	received := make(map[int]bool, len(session.Chunks))
+	for _, chunk := range session.Chunks {
+		received[chunk.Index] = true
+	}
+	missing := []int{}
+	for i := 0; i < session.ChunkCount(); i++ {
+		if !received[i] {
+			missing = append(missing, i)
+		}
+	}
+	return uploadSessionResponse{
+		UploadSession: session,
+		ChunkCount:    session.ChunkCount(),
+		MissingChunks: missing,
+	}
+}
+
+func (cfg *apiConfig) handlerUploadSessionCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		TotalSize int64 `json:"total_size"`
+		ChunkSize int64 `json:"chunk_size"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video data", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "401 Unauthorized", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.TotalSize <= 0 || params.TotalSize > maxSessionUploadSize {
+		msg := fmt.Sprintf("total_size must be between 1 and %d bytes", maxSessionUploadSize)
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+	if params.ChunkSize == 0 {
+		params.ChunkSize = defaultChunkSize
+	}
+	if params.ChunkSize < minChunkSize || params.ChunkSize > maxChunkSize {
+		msg := fmt.Sprintf("chunk_size must be between %d and %d bytes", minChunkSize, maxChunkSize)
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	quota, usage, err := cfg.userQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve quota", err)
+		return
+	}
+	err = checkUploadQuota(quota, usage, params.TotalSize, 0)
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
+	}
+
+	session, err := cfg.db.CreateUploadSession(database.CreateUploadSessionParams{
+		VideoID:   videoID,
+		UserID:    userID,
+		TotalSize: params.TotalSize,
+		ChunkSize: params.ChunkSize,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload session", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newUploadSessionResponse(session))
+}
+
+func (cfg *apiConfig) handlerUploadSessionGet(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.authorizeUploadSession(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newUploadSessionResponse(session))
+}
+
+func (cfg *apiConfig) handlerUploadSessionPutChunk(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.authorizeUploadSession(w, r)
+	if !ok {
+		return
+	}
+	if session.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload session is already complete", nil)
+		return
+	}
+
+	chunkIndex, err := strconv.Atoi(r.PathValue("chunkIndex"))
+	if err != nil || chunkIndex < 0 || chunkIndex >= session.ChunkCount() {
+		respondWithError(w, http.StatusBadRequest, "Invalid chunk index", err)
+		return
+	}
+
+	expectedOffset := int64(chunkIndex) * session.ChunkSize
+	expectedSize := min(session.ChunkSize, session.TotalSize-expectedOffset)
+	offsetString := r.URL.Query().Get("offset")
+	if offsetString != "" {
+		offset, err := strconv.ParseInt(offsetString, 10, 64)
+		if err != nil || offset != expectedOffset {
+			msg := fmt.Sprintf("Chunk %d must start at offset %d", chunkIndex, expectedOffset)
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, expectedSize)
+	chunkDir := cfg.uploadSessionDir(session.ID)
+	err = os.MkdirAll(chunkDir, 0755)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create chunk directory", err)
+		return
+	}
+	tmpFile, err := os.CreateTemp(chunkDir, ".chunk-*")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create temporary file", err)
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	written, err := io.Copy(tmpFile, r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read chunk contents", err)
+		return
+	}
+	if written != expectedSize {
+		msg := fmt.Sprintf("Chunk %d must be %d bytes, got %d", chunkIndex, expectedSize, written)
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't write chunk", err)
+		return
+	}
+	err = os.Rename(tmpFile.Name(), cfg.uploadChunkPath(session.ID, chunkIndex))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't write chunk", err)
+		return
+	}
+
+	err = cfg.db.SaveUploadChunk(session.ID, database.UploadChunk{
+		Index:  chunkIndex,
+		Offset: expectedOffset,
+		Size:   written,
+	})
+	if errors.Is(err, database.ErrUploadSessionCompleted) {
+		respondWithError(w, http.StatusConflict, "Upload session is already complete", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record chunk", err)
+		return
+	}
+
+	session, err = cfg.db.GetUploadSession(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve upload session", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newUploadSessionResponse(session))
+}
+
+func (cfg *apiConfig) handlerUploadSessionComplete(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.authorizeUploadSession(w, r)
+	if !ok {
+		return
+	}
+	if session.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload session is already complete", nil)
+		return
+	}
+
+	sessionResponse := newUploadSessionResponse(session)
+	if len(sessionResponse.MissingChunks) > 0 {
+		respondWithJSON(w, http.StatusConflict, sessionResponse)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(session.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video data", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	// Claim the session before touching its chunks, so concurrent or
+	// retried requests can't queue the upload twice. It's reopened if the
+	// upload isn't queued.
+	completed, err := cfg.db.CompleteUploadSession(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't complete upload session", err)
+		return
+	}
+	if !completed {
+		respondWithError(w, http.StatusConflict, "Upload session is already complete", nil)
+		return
+	}
+	queued := false
+	defer func() {
+		if queued {
+			return
+		}
+		err := cfg.db.ReopenUploadSession(session.ID)
+		if err != nil {
+			log.Printf("Couldn't reopen upload session %s: %v", session.ID, err)
+		}
+	}()
+	session, err = cfg.db.GetUploadSession(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve upload session", err)
+		return
+	}
+
+	tmpFile, err := os.CreateTemp("", "tubely-upload")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create temporary file", err)
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	err = cfg.assembleUploadSession(session, tmpFile)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't assemble uploaded chunks", err)
+		return
+	}
+
+	mimeType, media, err := validateVideoUpload(r.Context(), tmpFile)
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
+	}
+
+	// Other uploads may have used up the quota since the session started,
+	// e.g. if the plan changed. Completed sessions no longer count toward
+	// usage, so the session's size is added back here.
+	quota, usage, err := cfg.userQuota(session.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve quota", err)
+		return
+	}
+	err = checkUploadQuota(quota, usage, session.TotalSize, 0)
+	if err == nil {
+		err = checkDurationQuota(quota, media.Duration)
+	}
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
+	}
+
+	video, err = cfg.enqueueVideoJob(r.Context(), video, tmpFile, mimeType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing", err)
+		return
+	}
+	queued = true
+	os.RemoveAll(cfg.uploadSessionDir(session.ID))
+
+	cfg.respondWithVideo(w, r, http.StatusAccepted, video)
+}
+
+func (cfg *apiConfig) authorizeUploadSession(w http.ResponseWriter, r *http.Request) (database.UploadSession, bool) {
+	sessionIDString := r.PathValue("sessionID")
+	sessionID, err := uuid.Parse(sessionIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.UploadSession{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.UploadSession{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.UploadSession{}, false
+	}
+
+	session, err := cfg.db.GetUploadSession(sessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve upload session", err)
+		return database.UploadSession{}, false
+	}
+	if session.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Upload session not found", nil)
+		return database.UploadSession{}, false
+	}
+	if session.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "401 Unauthorized", nil)
+		return database.UploadSession{}, false
+	}
+	return session, true
+}
+
+func (cfg *apiConfig) assembleUploadSession(session database.UploadSession, dst io.Writer) error {
+	for _, chunk := range session.Chunks {
+		chunkFile, err := os.Open(cfg.uploadChunkPath(session.ID, chunk.Index))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, chunkFile)
+		chunkFile.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runUploadSessionSweeper deletes incomplete upload sessions that haven't
+// received a chunk for uploadSessionExpiry, along with their chunks, and
+// removes chunk directories left behind by sessions that are gone or
+// complete.
+func (cfg *apiConfig) runUploadSessionSweeper(ctx context.Context) {
+	for {
+		cutoff := time.Now().Add(-cfg.uploadSessionExpiry)
+		sessions, err := cfg.db.GetExpiredUploadSessions(cutoff, uploadSessionSweepBatchSize)
+		if err != nil {
+			log.Printf("Couldn't retrieve expired upload sessions: %v", err)
+		}
+		for _, session := range sessions {
+			err := os.RemoveAll(cfg.uploadSessionDir(session.ID))
+			if err != nil {
+				log.Printf("Couldn't remove chunks of upload session %s: %v", session.ID, err)
+				continue
+			}
+			err = cfg.db.DeleteUploadSession(session.ID)
+			if err != nil {
+				log.Printf("Couldn't delete upload session %s: %v", session.ID, err)
+			}
+		}
+		cfg.removeStaleChunkDirs(cutoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(uploadSessionSweepInterval):
+		}
+	}
+}
+
+func (cfg *apiConfig) removeStaleChunkDirs(cutoff time.Time) {
+	entries, err := os.ReadDir(cfg.uploadsRoot)
+	if err != nil {
+		log.Printf("Couldn't read %s: %v", cfg.uploadsRoot, err)
+		return
+	}
+	for _, entry := range entries {
+		sessionID, err := uuid.Parse(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		session, err := cfg.db.GetUploadSession(sessionID)
+		if err != nil {
+			log.Printf("Couldn't retrieve upload session %s: %v", sessionID, err)
+			continue
+		}
+		if session.ID != uuid.Nil && session.CompletedAt == nil {
+			continue
+		}
+		err = os.RemoveAll(cfg.uploadSessionDir(sessionID))
+		if err != nil {
+			log.Printf("Couldn't remove chunks of upload session %s: %v", sessionID, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) uploadSessionDir(sessionID uuid.UUID) string {
+	return filepath.Join(cfg.uploadsRoot, sessionID.String())
+}
+
+func (cfg *apiConfig) uploadChunkPath(sessionID uuid.UUID, chunkIndex int) string {
+	return filepath.Join(cfg.uploadSessionDir(sessionID), fmt.Sprintf("%06d.part", chunkIndex))
+}
@@ -1,20 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"image"
 	"io"
+	"log"
 	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/imageproc"
 	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
+	const maxUploadSize = 20 << 20 // 20 MB
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
@@ -49,6 +57,11 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	const maxMemory = 10 << 20
 	err = r.ParseMultipartForm(maxMemory)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Thumbnail is too large", err)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Couldn't parse thumbnail", err)
 		return
 	}
@@ -68,43 +81,161 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	extensions, err := mime.ExtensionsByType(mimeType)
+	quota, usage, err := cfg.userQuota(userID)
 	if err != nil {
-		msg := "Unable to parse file type"
-		respondWithError(w, http.StatusBadRequest, msg, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve quota", err)
 		return
 	}
-	if len(extensions) == 0 {
-		msg := fmt.Sprintf("No extensions found for %s", mimeType)
-		respondWithError(w, http.StatusBadRequest, msg, nil)
+	err = checkUploadQuota(quota, usage, fileHeaders.Size, videoMetadata.ThumbnailSizeBytes)
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
+	}
+
+	img, err := imageproc.Decode(fileData)
+	if errors.Is(err, imageproc.ErrTooManyPixels) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, err.Error(), err)
 		return
 	}
-	randomFilename, err := generateRandomFilename()
 	if err != nil {
-		msg := "Unable to generate filename"
-		respondWithError(w, http.StatusBadRequest, msg, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode thumbnail image", err)
 		return
 	}
-	fileName := fmt.Sprintf("%s%s", randomFilename, extensions[0])
-	filePath := filepath.Join(cfg.assetsRoot, fileName)
 
-	newFile, err := os.Create(filePath)
-	_, err = io.Copy(newFile, fileData)
+	visibility := videoMetadata.Visibility
+	thumbnailURL, srcset, thumbnailSize, err := cfg.saveThumbnail(r.Context(), visibilityKey(thumbnailKeyPrefix(videoID), visibility), img)
 	if err != nil {
-		msg := "Couldn't write thumbnail to file"
+		msg := "Couldn't store thumbnail"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
 
-	thumbnailURL := fmt.Sprintf("http://%s:%s/%s", baseWebsiteURL, cfg.port, filePath)
-	videoMetadata.ThumbnailURL = &thumbnailURL
-
-	err = cfg.db.UpdateVideo(videoMetadata)
+	// Encoding takes a while, so merge into a fresh read of the row rather
+	// than overwriting changes made meanwhile, such as a finished upload.
+	var previous database.Video
+	videoMetadata, err = cfg.mergeVideoUpdate(videoID, func(video database.Video) (database.Video, error) {
+		previous = video
+		video.ThumbnailURL = &thumbnailURL
+		video.ThumbnailSrcset = srcset
+		video.ThumbnailSizeBytes = thumbnailSize
+		return video, nil
+	})
+	if err != nil {
+		saved := database.Video{ThumbnailURL: &thumbnailURL, ThumbnailSrcset: srcset}
+		cfg.scheduleStorageDeletions(r.Context(), videoID, cfg.thumbnailTargets(saved))
+	}
+	if errors.Is(err, errVideoDeleted) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update thumbnail URL", err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, videoMetadata)
+	cfg.scheduleStorageDeletions(r.Context(), videoID, cfg.thumbnailTargets(previous))
+	if videoMetadata.Visibility != visibility {
+		videoMetadata, err = cfg.moveVideoObjectsForResponse(r.Context(), videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't move video objects", err)
+			return
+		}
+	}
+	cfg.respondWithVideo(w, r, http.StatusOK, videoMetadata)
+}
+
+var thumbnailWidths = []int{320, 640, 1280}
+
+type thumbnailFormat struct {
+	mimeType  string
+	extension string
+	encode    func(ctx context.Context, w io.Writer, img image.Image) error
+}
+
+var thumbnailFormats = []thumbnailFormat{
+	{
+		mimeType:  "image/jpeg",
+		extension: ".jpg",
+		encode: func(ctx context.Context, w io.Writer, img image.Image) error {
+			return imageproc.EncodeJPEG(w, img)
+		},
+	},
+	{
+		mimeType:  "image/webp",
+		extension: ".webp",
+		encode:    imageproc.EncodeWebP,
+	},
+}
+
+// variantWidths returns the configured widths that don't upscale the source,
+// plus the source width itself when it is smaller than the largest variant.
+func variantWidths(sourceWidth int) []int {
+	widths := []int{}
+	for _, width := range thumbnailWidths {
+		if width < sourceWidth {
+			widths = append(widths, width)
+		}
+	}
+	if sourceWidth <= thumbnailWidths[len(thumbnailWidths)-1] {
+		widths = append(widths, sourceWidth)
+	}
+	return widths
+}
+
+// saveThumbnail re-encodes the image at several widths in every thumbnail
+// format and stores the variants under keyPrefix. It returns the ref of the
+// largest JPEG, a srcset string per MIME type and the total bytes stored.
+// On failure, the variants stored so far are deleted.
+func (cfg *apiConfig) saveThumbnail(ctx context.Context, keyPrefix string, img image.Image) (string, database.StringMap, int64, error) {
+	randomFilename, err := generateRandomFilename()
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	stored := []string{}
+	fail := func(err error) (string, database.StringMap, int64, error) {
+		for _, key := range stored {
+			deleteErr := cfg.storage.Delete(context.WithoutCancel(ctx), key)
+			if deleteErr != nil {
+				log.Printf("Couldn't delete %s: %v", key, deleteErr)
+			}
+		}
+		return "", nil, 0, err
+	}
+
+	srcset := database.StringMap{}
+	thumbnailURL := ""
+	var size int64
+	for _, width := range variantWidths(img.Bounds().Dx()) {
+		resized := imageproc.Resize(img, width)
+		for _, format := range thumbnailFormats {
+			var encoded bytes.Buffer
+			err := format.encode(ctx, &encoded, resized)
+			if err != nil {
+				return fail(err)
+			}
+			size += int64(encoded.Len())
+			key := fmt.Sprintf("%s%s-%d%s", keyPrefix, randomFilename, width, format.extension)
+			err = cfg.storage.Put(ctx, key, bytes.NewReader(encoded.Bytes()), format.mimeType)
+			if err != nil {
+				return fail(err)
+			}
+			stored = append(stored, key)
+
+			variantURL := cfg.objectRef(key)
+			if srcset[format.mimeType] != "" {
+				srcset[format.mimeType] += ", "
+			}
+			srcset[format.mimeType] += fmt.Sprintf("%s %dw", variantURL, width)
+			if format.mimeType == "image/jpeg" {
+				thumbnailURL = variantURL
+			}
+		}
+	}
+	return thumbnailURL, srcset, size, nil
+}
+
+func thumbnailKeyPrefix(videoID uuid.UUID) string {
+	return fmt.Sprintf("thumbnails/%s/", videoID)
 }
 
 func generateRandomFilename() (string, error) {
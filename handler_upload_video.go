@@ -1,29 +1,28 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math"
-	"mime"
 	"net/http"
 	"os"
 	"os/exec"
-	"strings"
-	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/imageproc"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mediaprobe"
 	"github.com/google/uuid"
 )
 
-func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
-	const maxUploadSize = 1 << 30 // 1 GB
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+// multipartOverhead allows for the boundaries and part headers around an
+// uploaded file.
+const multipartOverhead = 1 << 20 // 1 MB
 
+func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
@@ -53,22 +52,34 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	quota, usage, err := cfg.userQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve quota", err)
+		return
+	}
+
+	// Refuse bodies that can't fit the plan before they're parsed.
+	r.Body = http.MaxBytesReader(w, r.Body, quota.MaxFileBytes+multipartOverhead)
+
 	key := "video"
-	fileData, _, err := r.FormFile(key)
+	fileData, fileHeader, err := r.FormFile(key)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File is larger than the %d byte limit", quota.MaxFileBytes), err)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video data", err)
 		return
 	}
 	defer fileData.Close()
-
-	mimeType := "video/mp4"
-	mediaType, _, err := mime.ParseMediaType(mimeType)
-	if mediaType != mimeType {
-		msg := fmt.Sprintf("Invalid media type '%s' provided. Media type must be 'video/mp4'", mediaType)
-		respondWithError(w, http.StatusBadRequest, msg, nil)
+	err = checkUploadQuota(quota, usage, fileHeader.Size, 0)
+	if err != nil {
+		respondWithUploadError(w, err)
 		return
 	}
-	tmpFile, err := os.CreateTemp("", "tubely-upload.mp4")
+
+	tmpFile, err := os.CreateTemp("", "tubely-upload")
 	if err != nil {
 		msg := "Couldn't create temporary file"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
@@ -84,233 +95,356 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	aspectRatio, err := getVideoAspectRatio(tmpFile.Name())
+	mimeType, media, err := validateVideoUpload(r.Context(), tmpFile)
 	if err != nil {
-		msg := "Couldn't calculate aspect ratio"
-		respondWithError(w, http.StatusInternalServerError, msg, err)
+		respondWithUploadError(w, err)
 		return
 	}
-	videoPrefix := "other/"
-	if aspectRatio == "9:16" {
-		videoPrefix = "portrait/"
-	}
-	if aspectRatio == "16:9" {
-		videoPrefix = "landscape/"
+	err = checkDurationQuota(quota, media.Duration)
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
 	}
 
-	processedFileName, err := processVideoForFastStart(tmpFile.Name())
+	videoMetadata, err = cfg.enqueueVideoJob(r.Context(), videoMetadata, tmpFile, mimeType)
 	if err != nil {
-		msg := "Couldn't process video for fast start"
-		respondWithError(w, http.StatusInternalServerError, msg, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing", err)
 		return
 	}
+	cfg.respondWithVideo(w, r, http.StatusAccepted, videoMetadata)
+}
+
+func (cfg *apiConfig) processVideo(ctx context.Context, videoID uuid.UUID, filePath string) (database.Video, error) {
+	sourceInfo, err := os.Stat(filePath)
+	if err != nil {
+		return database.Video{}, err
+	}
+	media, err := mediaprobe.Probe(ctx, filePath)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't probe video: %w", err)
+	}
+	if !media.HasVideo {
+		return database.Video{}, errors.New("file has no video stream")
+	}
+	width, height := media.DisplaySize()
+	if width <= 0 || height <= 0 {
+		return database.Video{}, fmt.Errorf("invalid video dimensions %dx%d", width, height)
+	}
+	aspectRatio := calculateAspectRatio(width, height)
+	videoPrefix := aspectRatioPrefix(aspectRatio)
+
+	processedFileName, err := processVideoForFastStart(ctx, filePath, media)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't process video for fast start: %w", err)
+	}
 	processedFile, err := os.Open(processedFileName)
 	if err != nil {
-		msg := "Couldn't open processed video"
-		respondWithError(w, http.StatusInternalServerError, msg, err)
-		return
+		return database.Video{}, fmt.Errorf("couldn't open processed video: %w", err)
 	}
 	defer os.Remove(processedFileName)
 	defer processedFile.Close()
 
 	randomFilename, err := generateRandomFilename()
 	if err != nil {
-		msg := "Unable to generate filename"
-		respondWithError(w, http.StatusBadRequest, msg, err)
-		return
+		return database.Video{}, fmt.Errorf("unable to generate filename: %w", err)
+	}
+	// Objects go straight under privateKeyPrefix for private videos. If the
+	// visibility changes while the job runs, they're moved at the end.
+	initial, err := cfg.db.GetVideoIncludingTrashed(videoID)
+	if err != nil {
+		return database.Video{}, err
 	}
-	s3Key := videoPrefix + randomFilename + ".mp4"
+	baseKey := visibilityKey(videoPrefix+randomFilename, initial.Visibility)
+	storageKey := baseKey + ".mp4"
 
-	putObjectInput := s3.PutObjectInput{
-		Bucket:      &cfg.s3Bucket,
-		Key:         &s3Key,
-		Body:        processedFile,
-		ContentType: &mimeType,
+	// Until the video points at them, the objects stored below belong to
+	// this attempt alone, so a failure deletes them before any retry.
+	var extracted database.Video
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		targets := []storageTarget{
+			{key: storageKey},
+			{key: baseKey + "/", isPrefix: true},
+		}
+		targets = append(targets, cfg.thumbnailTargets(extracted)...)
+		cfg.scheduleStorageDeletions(context.WithoutCancel(ctx), videoID, targets)
+	}()
+
+	err = cfg.storage.Put(ctx, storageKey, processedFile, "video/mp4")
+	if err != nil {
+		return database.Video{}, fmt.Errorf("unable to store video: %w", err)
+	}
+
+	hlsDir, err := transcodeToHLS(ctx, filePath, width, height)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't transcode HLS renditions: %w", err)
 	}
-	_, err = cfg.s3Client.PutObject(r.Context(), &putObjectInput)
+	defer os.RemoveAll(hlsDir)
+	hlsPrefix := baseKey + "/hls/"
+	err = cfg.uploadDir(ctx, hlsDir, hlsPrefix)
 	if err != nil {
-		msg := "Unable to store video in S3"
-		respondWithError(w, http.StatusBadRequest, msg, err)
-		return
+		return database.Video{}, fmt.Errorf("unable to store HLS renditions: %w", err)
 	}
 
-	cdnVideoURL := cfg.s3CfDistribution + s3Key
-	videoMetadata.VideoURL = &cdnVideoURL
+	sprites, err := generateSprites(ctx, filePath, width, height, media.Duration)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't generate sprite sheets: %w", err)
+	}
+	defer os.RemoveAll(sprites.Dir)
+	spritesPrefix := baseKey + "/sprites/"
+	err = cfg.uploadDir(ctx, sprites.Dir, spritesPrefix)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("unable to store sprite sheets: %w", err)
+	}
 
-	err = cfg.db.UpdateVideo(videoMetadata)
+	var dashPrefix string
+	if cfg.dashEnabled {
+		dashDir, err := transcodeToDASH(ctx, filePath, width, height, media.HasAudio)
+		if err != nil {
+			return database.Video{}, fmt.Errorf("couldn't transcode DASH renditions: %w", err)
+		}
+		defer os.RemoveAll(dashDir)
+		dashPrefix = baseKey + "/dash/"
+		err = cfg.uploadDir(ctx, dashDir, dashPrefix)
+		if err != nil {
+			return database.Video{}, fmt.Errorf("unable to store DASH renditions: %w", err)
+		}
+	}
+
+	// A frame is only extracted for videos without a thumbnail. The check is
+	// repeated when the results are written, because a thumbnail the user
+	// uploads meanwhile always wins.
+	current, err := cfg.db.GetVideoIncludingTrashed(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update video URL", err)
-		return
+		return database.Video{}, err
+	}
+	if current.ThumbnailURL == nil {
+		extracted, err = cfg.saveExtractedThumbnail(ctx, videoID, current.Visibility, filePath, media.Duration)
+		if err != nil {
+			return database.Video{}, err
+		}
+	}
+
+	videoURL := cfg.objectRef(storageKey)
+	hlsURL := cfg.objectRef(hlsPrefix + "master.m3u8")
+	spriteVTTURL := cfg.objectRef(spritesPrefix + spriteVTTFileName)
+	spriteSheetURLs := database.StringList{}
+	for _, sheetName := range sprites.SheetNames {
+		spriteSheetURLs = append(spriteSheetURLs, cfg.objectRef(spritesPrefix+sheetName))
+	}
+	var dashURL *string
+	if dashPrefix != "" {
+		manifestURL := cfg.objectRef(dashPrefix + "manifest.mpd")
+		dashURL = &manifestURL
+	}
+
+	// Everything slow is done, so merge the results into a fresh read of the
+	// row. Metadata edited while the job ran isn't overwritten.
+	var (
+		legacyVersion *database.VideoVersion
+		version       *database.VideoVersion
+		usedThumbnail bool
+	)
+	video, err := cfg.mergeVideoUpdate(videoID, func(video database.Video) (database.Video, error) {
+		previous := video
+		usedThumbnail = video.ThumbnailURL == nil && extracted.ThumbnailURL != nil
+		if usedThumbnail {
+			video.ThumbnailURL = extracted.ThumbnailURL
+			video.ThumbnailSrcset = extracted.ThumbnailSrcset
+			video.ThumbnailSizeBytes = extracted.ThumbnailSizeBytes
+		}
+		video.MediaInfo = mediaInfoFromMetadata(media, aspectRatio)
+		// Quotas count the uploaded file, not the renditions made from it.
+		video.SizeBytes = sourceInfo.Size()
+		video.VideoURL = &videoURL
+		video.HLSURL = &hlsURL
+		video.SpriteVTTURL = &spriteVTTURL
+		video.SpriteSheetURLs = spriteSheetURLs
+		video.DASHURL = dashURL
+
+		// Versions are recorded once, even if the write has to be retried.
+		// Videos processed before versioning existed get their current upload
+		// recorded first so it can be rolled back to.
+		if version == nil && previous.CurrentVersion == nil && previous.VideoURL != nil {
+			recorded, err := cfg.db.CreateVideoVersion(previous)
+			if err != nil {
+				return database.Video{}, fmt.Errorf("couldn't record previous version: %w", err)
+			}
+			legacyVersion = &recorded
+		}
+		if version == nil {
+			recorded, err := cfg.db.CreateVideoVersion(video)
+			if err != nil {
+				return database.Video{}, fmt.Errorf("couldn't record version: %w", err)
+			}
+			version = &recorded
+		}
+		video.CurrentVersion = &version.Version
+		return video, nil
+	})
+	if err != nil {
+		for _, recorded := range []*database.VideoVersion{legacyVersion, version} {
+			if recorded != nil {
+				cfg.db.DeleteVideoVersion(recorded.ID)
+			}
+		}
+	}
+	if errors.Is(err, errVideoDeleted) {
+		cfg.scheduleStorageDeletions(ctx, videoID, []storageTarget{
+			{key: thumbnailKeyPrefix(videoID), isPrefix: true},
+			{key: privateKeyPrefix + thumbnailKeyPrefix(videoID), isPrefix: true},
+		})
+		return database.Video{}, errors.New("video was deleted while processing")
+	}
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't update video URL: %w", err)
+	}
+	committed = true
+	if extracted.ThumbnailURL != nil && !usedThumbnail {
+		cfg.scheduleStorageDeletions(ctx, videoID, cfg.thumbnailTargets(extracted))
+	}
+	cfg.purgeVideoVersions(ctx, video)
+
+	err = cfg.moveVideoObjects(ctx, videoID)
+	if err != nil {
+		log.Printf("Couldn't move objects of video %s: %v", videoID, err)
+	}
+	return video, nil
+}
+
+// saveExtractedThumbnail stores a frame of the video as its thumbnail. The
+// returned video only has the thumbnail fields set, and none if no frame
+// could be extracted.
+func (cfg *apiConfig) saveExtractedThumbnail(ctx context.Context, videoID uuid.UUID, visibility, filePath string, duration float64) (database.Video, error) {
+	thumbnailPath, err := extractThumbnail(ctx, filePath, duration)
+	if err != nil {
+		log.Printf("Couldn't extract thumbnail for video %s: %v", videoID, err)
+	}
+	if thumbnailPath == "" {
+		return database.Video{}, nil
+	}
+	defer os.Remove(thumbnailPath)
+
+	thumbnailFile, err := os.Open(thumbnailPath)
+	if err != nil {
+		return database.Video{}, err
+	}
+	defer thumbnailFile.Close()
+	img, err := imageproc.Decode(thumbnailFile)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't decode extracted thumbnail: %w", err)
+	}
+	thumbnailURL, srcset, thumbnailSize, err := cfg.saveThumbnail(ctx, visibilityKey(thumbnailKeyPrefix(videoID), visibility), img)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't save extracted thumbnail: %w", err)
+	}
+	return database.Video{
+		ThumbnailURL:       &thumbnailURL,
+		ThumbnailSrcset:    srcset,
+		ThumbnailSizeBytes: thumbnailSize,
+	}, nil
+}
+
+func mediaInfoFromMetadata(media mediaprobe.Metadata, aspectRatio string) database.MediaInfo {
+	width, height := media.DisplaySize()
+	return database.MediaInfo{
+		DurationSeconds: &media.Duration,
+		Width:           &width,
+		Height:          &height,
+		AspectRatio:     &aspectRatio,
+		VideoCodec:      &media.VideoCodec,
+		Bitrate:         &media.BitRate,
+		FrameRate:       &media.FrameRate,
+		Rotation:        &media.Rotation,
+		AudioChannels:   &media.AudioChannels,
+		ContainerFormat: &media.ContainerFormat,
 	}
-	respondWithJSON(w, http.StatusOK, videoMetadata)
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	type videoMetadata struct {
-		Streams []struct {
-			Index              int    `json:"index"`
-			CodecName          string `json:"codec_name,omitempty"`
-			CodecLongName      string `json:"codec_long_name,omitempty"`
-			Profile            string `json:"profile,omitempty"`
-			CodecType          string `json:"codec_type"`
-			CodecTagString     string `json:"codec_tag_string"`
-			CodecTag           string `json:"codec_tag"`
-			Width              int    `json:"width,omitempty"`
-			Height             int    `json:"height,omitempty"`
-			CodedWidth         int    `json:"coded_width,omitempty"`
-			CodedHeight        int    `json:"coded_height,omitempty"`
-			ClosedCaptions     int    `json:"closed_captions,omitempty"`
-			FilmGrain          int    `json:"film_grain,omitempty"`
-			HasBFrames         int    `json:"has_b_frames,omitempty"`
-			SampleAspectRatio  string `json:"sample_aspect_ratio,omitempty"`
-			DisplayAspectRatio string `json:"display_aspect_ratio,omitempty"`
-			PixFmt             string `json:"pix_fmt,omitempty"`
-			Level              int    `json:"level,omitempty"`
-			ColorRange         string `json:"color_range,omitempty"`
-			ColorSpace         string `json:"color_space,omitempty"`
-			ColorTransfer      string `json:"color_transfer,omitempty"`
-			ColorPrimaries     string `json:"color_primaries,omitempty"`
-			ChromaLocation     string `json:"chroma_location,omitempty"`
-			FieldOrder         string `json:"field_order,omitempty"`
-			Refs               int    `json:"refs,omitempty"`
-			IsAvc              string `json:"is_avc,omitempty"`
-			NalLengthSize      string `json:"nal_length_size,omitempty"`
-			ID                 string `json:"id"`
-			RFrameRate         string `json:"r_frame_rate"`
-			AvgFrameRate       string `json:"avg_frame_rate"`
-			TimeBase           string `json:"time_base"`
-			StartPts           int    `json:"start_pts"`
-			StartTime          string `json:"start_time"`
-			DurationTs         int    `json:"duration_ts"`
-			Duration           string `json:"duration"`
-			BitRate            string `json:"bit_rate,omitempty"`
-			BitsPerRawSample   string `json:"bits_per_raw_sample,omitempty"`
-			NbFrames           string `json:"nb_frames"`
-			ExtradataSize      int    `json:"extradata_size"`
-			Disposition        struct {
-				Default         int `json:"default"`
-				Dub             int `json:"dub"`
-				Original        int `json:"original"`
-				Comment         int `json:"comment"`
-				Lyrics          int `json:"lyrics"`
-				Karaoke         int `json:"karaoke"`
-				Forced          int `json:"forced"`
-				HearingImpaired int `json:"hearing_impaired"`
-				VisualImpaired  int `json:"visual_impaired"`
-				CleanEffects    int `json:"clean_effects"`
-				AttachedPic     int `json:"attached_pic"`
-				TimedThumbnails int `json:"timed_thumbnails"`
-				NonDiegetic     int `json:"non_diegetic"`
-				Captions        int `json:"captions"`
-				Descriptions    int `json:"descriptions"`
-				Metadata        int `json:"metadata"`
-				Dependent       int `json:"dependent"`
-				StillImage      int `json:"still_image"`
-				Multilayer      int `json:"multilayer"`
-			} `json:"disposition"`
-			Tags struct {
-				Language    string `json:"language"`
-				HandlerName string `json:"handler_name"`
-				VendorID    string `json:"vendor_id"`
-				Encoder     string `json:"encoder"`
-				Timecode    string `json:"timecode"`
-			} `json:"tags,omitempty"`
-			SampleFmt      string `json:"sample_fmt,omitempty"`
-			SampleRate     string `json:"sample_rate,omitempty"`
-			Channels       int    `json:"channels,omitempty"`
-			ChannelLayout  string `json:"channel_layout,omitempty"`
-			BitsPerSample  int    `json:"bits_per_sample,omitempty"`
-			InitialPadding int    `json:"initial_padding,omitempty"`
-			Tags0          struct {
-				Language    string `json:"language"`
-				HandlerName string `json:"handler_name"`
-				VendorID    string `json:"vendor_id"`
-			} `json:"tags,omitempty"`
-			Tags1 struct {
-				Language    string `json:"language"`
-				HandlerName string `json:"handler_name"`
-				Timecode    string `json:"timecode"`
-			} `json:"tags,omitempty"`
-		} `json:"streams"`
-	}
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-	var outBuffer bytes.Buffer
-	cmd.Stdout = &outBuffer
-	err := cmd.Run()
-	if err != nil {
-		return "", err
-	}
-
-	vidMetadata := videoMetadata{}
-	err = json.Unmarshal(outBuffer.Bytes(), &vidMetadata)
-	if err != nil {
-		return "", err
-	}
-	height := vidMetadata.Streams[0].Height
-	width := vidMetadata.Streams[0].Width
-	return calculateAspectRatio(width, height), nil
+type aspectRatioBucket struct {
+	name   string
+	ratio  float64
+	prefix string
+}
+
+var aspectRatioBuckets = []aspectRatioBucket{
+	{name: "16:9", ratio: 16.0 / 9.0, prefix: "landscape/"},
+	{name: "9:16", ratio: 9.0 / 16.0, prefix: "portrait/"},
+	{name: "4:3", ratio: 4.0 / 3.0, prefix: "standard/"},
+	{name: "3:4", ratio: 3.0 / 4.0, prefix: "portrait-standard/"},
+	{name: "1:1", ratio: 1.0, prefix: "square/"},
+	{name: "21:9", ratio: 21.0 / 9.0, prefix: "ultrawide/"},
 }
 
+const otherAspectRatioPrefix = "other/"
+
+// calculateAspectRatio returns the closest known ratio to the display size,
+// or "other" if none is within tolerance.
 func calculateAspectRatio(width, height int) string {
-	sixteenByNine := 16.0 / 9.0
-	nineBySixteen := 9.0 / 16.0
+	if width <= 0 || height <= 0 {
+		return "other"
+	}
 	ratio := float64(width) / float64(height)
 
-	tolerange := 0.1
-	if math.Abs(ratio-sixteenByNine) <= tolerange {
-		return "16:9"
+	tolerance := 0.1
+	closest := "other"
+	closestDistance := math.Inf(1)
+	for _, bucket := range aspectRatioBuckets {
+		distance := math.Abs(ratio - bucket.ratio)
+		if distance <= tolerance && distance < closestDistance {
+			closest = bucket.name
+			closestDistance = distance
+		}
 	}
-	if math.Abs(ratio-nineBySixteen) <= tolerange {
-		return "9:16"
+	return closest
+}
+
+func aspectRatioPrefix(aspectRatio string) string {
+	for _, bucket := range aspectRatioBuckets {
+		if bucket.name == aspectRatio {
+			return bucket.prefix
+		}
 	}
-	return "other"
+	return otherAspectRatioPrefix
 }
 
-func processVideoForFastStart(filePath string) (string, error) {
+// processVideoForFastStart writes an MP4 with the moov atom up front. H.264
+// and AAC streams are remuxed from any container; other codecs (HEVC, VP9,
+// Opus...) are re-encoded so every source ends up as a browser-friendly MP4.
+func processVideoForFastStart(ctx context.Context, filePath string, media mediaprobe.Metadata) (string, error) {
 	outputPath := filePath + ".processing"
-	cmd := exec.Command(
-		"ffmpeg",
+
+	videoCodec := "copy"
+	if media.VideoCodec != "h264" {
+		videoCodec = "libx264"
+	}
+	audioCodec := "copy"
+	if media.AudioCodec != "aac" && media.AudioCodec != "mp3" {
+		audioCodec = "aac"
+	}
+
+	args := []string{
 		"-i", filePath,
-		"-c", "copy",
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-c:v", videoCodec,
+	}
+	if videoCodec == "libx264" {
+		args = append(args, "-preset", "veryfast", "-crf", "20", "-pix_fmt", "yuv420p")
+	}
+	args = append(args,
+		"-c:a", audioCodec,
 		"-movflags", "faststart",
 		"-f", "mp4",
 		outputPath,
 	)
-	err := cmd.Run()
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
 	if err != nil {
-		return "", err
+		os.Remove(outputPath)
+		return "", fmt.Errorf("%w: %s", err, lastLine(output))
 	}
 	return outputPath, nil
 }
-
-func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
-	presignClient := s3.NewPresignClient(s3Client)
-	presignedRequest, err := presignClient.PresignGetObject(
-		context.Background(),
-		&s3.GetObjectInput{
-			Bucket: &bucket,
-			Key:    &key,
-		},
-		s3.WithPresignExpires(expireTime),
-	)
-	if err != nil {
-		return "", err
-	}
-	return presignedRequest.URL, nil
-}
-
-func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
-	expireTime := 5 * time.Minute
-	parts := strings.Split(*video.VideoURL, ",")
-	if len(parts) < 2 {
-		return database.Video{}, fmt.Errorf("Couldn't parse bucket and key")
-	}
-	bucket := parts[0]
-	key := parts[1]
-	presignedURL, err := generatePresignedURL(cfg.s3Client, bucket, key, expireTime)
-	if err != nil {
-		return database.Video{}, err
-	}
-	*video.VideoURL = presignedURL
-	return video, nil
-}
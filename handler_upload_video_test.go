@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mediaprobe"
+)
+
+func TestCalculateAspectRatio(t *testing.T) {
+	tests := []struct {
+		name  string
+		media mediaprobe.Metadata
+		want  string
+	}{
+		{name: "1080p", media: mediaprobe.Metadata{Width: 1920, Height: 1080}, want: "16:9"},
+		{name: "vertical phone video", media: mediaprobe.Metadata{Width: 1080, Height: 1920}, want: "9:16"},
+		{name: "rotated phone video", media: mediaprobe.Metadata{Width: 1920, Height: 1080, Rotation: 90}, want: "9:16"},
+		{name: "upside down", media: mediaprobe.Metadata{Width: 1920, Height: 1080, Rotation: 180}, want: "16:9"},
+		{name: "4:3", media: mediaprobe.Metadata{Width: 640, Height: 480}, want: "4:3"},
+		{name: "rotated 4:3", media: mediaprobe.Metadata{Width: 640, Height: 480, Rotation: 270}, want: "3:4"},
+		{name: "square", media: mediaprobe.Metadata{Width: 720, Height: 720}, want: "1:1"},
+		{name: "ultrawide", media: mediaprobe.Metadata{Width: 2560, Height: 1080}, want: "21:9"},
+		{name: "within tolerance", media: mediaprobe.Metadata{Width: 1280, Height: 704}, want: "16:9"},
+		{name: "between buckets", media: mediaprobe.Metadata{Width: 1500, Height: 1000}, want: "other"},
+		{name: "very wide", media: mediaprobe.Metadata{Width: 4000, Height: 1000}, want: "other"},
+		{name: "no dimensions", media: mediaprobe.Metadata{}, want: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height := tt.media.DisplaySize()
+			if got := calculateAspectRatio(width, height); got != tt.want {
+				t.Fatalf("calculateAspectRatio(%d, %d) = %q, want %q", width, height, got, tt.want)
+			}
+		})
+	}
+}
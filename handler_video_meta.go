@@ -2,7 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -33,6 +38,25 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	if params.Visibility != "" && !database.ValidVideoVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be 'public', 'unlisted' or 'private'", nil)
+		return
+	}
+	err = validateVideoMetadata(params.Title, params.Description)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	quota, usage, err := cfg.userQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve quota", err)
+		return
+	}
+	if usage.Videos >= quota.MaxVideos {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Your plan is limited to %d videos", quota.MaxVideos), nil)
+		return
+	}
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -40,9 +64,11 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, video)
+	cfg.respondWithVideo(w, r, http.StatusCreated, video)
 }
 
+// handlerVideoMetaDelete moves a video to the trash. runTrashPurger deletes
+// it for good once trashRetention has passed.
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -72,7 +98,7 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	err = cfg.db.TrashVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -89,14 +115,41 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, err := cfg.requestUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
 	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, video)
+	// Private videos the caller can't watch are reported as missing rather
+	// than forbidden so their existence isn't leaked.
+	canView, err := cfg.canViewVideo(video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if video.ID == uuid.Nil || !canView {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	// Owners checking on their own videos don't count as views.
+	if userID != video.UserID {
+		err = cfg.db.IncrementVideoViews(video.ID)
+		if err != nil {
+			log.Printf("Couldn't count view of video %s: %v", video.ID, err)
+		}
+	}
+	w.Header().Set("ETag", videoETag(video))
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
 }
 
+// handlerVideosRetrieve lists the caller's own videos, a page at a time.
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -109,10 +162,84 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	params, err := parseVideoListParams(r)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, videos)
+	params.UserID = userID
+	cfg.respondWithVideoPage(w, r, params)
+}
+
+func parseVideoListParams(r *http.Request) (database.ListVideosParams, error) {
+	query := r.URL.Query()
+	params := database.ListVideosParams{
+		TitleContains: query.Get("title"),
+		AspectRatio:   query.Get("aspect_ratio"),
+		Status:        query.Get("status"),
+		Sort:          query.Get("sort"),
+		Cursor:        query.Get("cursor"),
+	}
+
+	if params.Sort == "" {
+		params.Sort = database.VideoSortNewest
+	}
+	if !database.ValidVideoSort(params.Sort) || params.Sort == database.VideoSortDeleted {
+		return database.ListVideosParams{}, errors.New("sort must be 'newest', 'oldest', 'title' or 'most_viewed'")
+	}
+	switch params.Status {
+	case "", database.VideoJobStatusQueued, database.VideoJobStatusProcessing, database.VideoJobStatusReady, database.VideoJobStatusFailed:
+	default:
+		return database.ListVideosParams{}, errors.New("status must be 'queued', 'processing', 'ready' or 'failed'")
+	}
+
+	var err error
+	params.Limit, err = parsePageLimit(r)
+	if err != nil {
+		return database.ListVideosParams{}, err
+	}
+	params.CreatedAfter, err = parseTimeParam(query.Get("created_after"))
+	if err != nil {
+		return database.ListVideosParams{}, fmt.Errorf("invalid created_after: %w", err)
+	}
+	params.CreatedBefore, err = parseTimeParam(query.Get("created_before"))
+	if err != nil {
+		return database.ListVideosParams{}, fmt.Errorf("invalid created_before: %w", err)
+	}
+	params.HasVideo, err = parseBoolParam(query.Get("has_video"))
+	if err != nil {
+		return database.ListVideosParams{}, fmt.Errorf("invalid has_video: %w", err)
+	}
+	params.HasThumbnail, err = parseBoolParam(query.Get("has_thumbnail"))
+	if err != nil {
+		return database.ListVideosParams{}, fmt.Errorf("invalid has_thumbnail: %w", err)
+	}
+	return params, nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps and plain dates, which are
+// taken as midnight UTC.
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, errors.New("expected an RFC 3339 timestamp or a YYYY-MM-DD date")
+		}
+	}
+	return &t, nil
+}
+
+func parseBoolParam(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
 }
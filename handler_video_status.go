@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoStatus(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		VideoID   uuid.UUID  `json:"video_id"`
+		Status    *string    `json:"status"`
+		Attempts  int        `json:"attempts"`
+		Error     *string    `json:"error"`
+		UpdatedAt *time.Time `json:"updated_at"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "401 Unauthorized", nil)
+		return
+	}
+
+	job, err := cfg.db.GetLatestVideoJob(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get processing job", err)
+		return
+	}
+
+	resp := response{
+		VideoID: videoID,
+		Status:  video.ProcessingStatus,
+	}
+	if job.ID != uuid.Nil {
+		resp.Attempts = job.Attempts
+		resp.Error = job.LastError
+		resp.UpdatedAt = &job.UpdatedAt
+	}
+	// Videos uploaded before the job queue existed have no status but are playable.
+	if resp.Status == nil && video.VideoURL != nil {
+		ready := database.VideoJobStatusReady
+		resp.Status = &ready
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTitleLength       = 100
+	maxDescriptionLength = 5000
+)
+
+// validateVideoMetadata checks the user-editable text fields of a video.
+// Lengths are counted in characters, not bytes.
+func validateVideoMetadata(title, description string) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("title must not be empty")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return fmt.Errorf("title must be at most %d characters", maxTitleLength)
+	}
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxDescriptionLength)
+	}
+	return nil
+}
+
+// videoETag identifies a revision of the video's metadata. UpdateVideo sets
+// updated_at with nanosecond precision, so every write yields a new tag.
+func videoETag(video database.Video) string {
+	return fmt.Sprintf(`"%d"`, video.UpdatedAt.UnixNano())
+}
+
+// etagMatches reports whether an If-Match header value lists etag. Only
+// strong comparison is allowed for If-Match, so weak tags never match.
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// videoUpdateAttempts bounds how often mergeVideoUpdate retries after losing
+// a race with another write.
+const videoUpdateAttempts = 5
+
+var errVideoDeleted = errors.New("video was deleted")
+
+// mergeVideoUpdate re-reads the video, applies mutate and writes the result
+// only if nothing else changed the row in between, retrying on conflicts.
+// Slow work, such as transcoding or encoding images, must happen before it
+// so that edits made meanwhile aren't overwritten. mutate may run more than
+// once. Videos in the trash are included; a missing video yields
+// errVideoDeleted.
+func (cfg *apiConfig) mergeVideoUpdate(videoID uuid.UUID, mutate func(database.Video) (database.Video, error)) (database.Video, error) {
+	for attempt := 1; ; attempt++ {
+		video, err := cfg.db.GetVideoIncludingTrashed(videoID)
+		if err != nil {
+			return database.Video{}, err
+		}
+		if video.ID == uuid.Nil {
+			return database.Video{}, errVideoDeleted
+		}
+		video, err = mutate(video)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video, err = cfg.db.UpdateVideoIfUnmodified(video)
+		if errors.Is(err, database.ErrVideoModified) && attempt < videoUpdateAttempts {
+			continue
+		}
+		return video, err
+	}
+}
+
+// videoPatch holds the fields set by a metadata update.
+type videoPatch struct {
+	title       *string
+	description *string
+	visibility  *string
+}
+
+func (patch videoPatch) apply(video database.Video) database.Video {
+	if patch.title != nil {
+		video.Title = *patch.title
+	}
+	if patch.description != nil {
+		video.Description = *patch.description
+	}
+	if patch.visibility != nil {
+		video.Visibility = *patch.visibility
+	}
+	return video
+}
+
+// handlerVideoMetaUpdate applies a JSON merge patch (RFC 7396) to the title,
+// description and visibility of a video. Sending If-Match with the ETag
+// from a previous response makes the update fail with 412 if the video has
+// changed since. Without it, the patch is merged into the latest version.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !etagMatches(ifMatch, videoETag(video)) {
+		w.Header().Set("ETag", videoETag(video))
+		respondWithError(w, http.StatusPreconditionFailed, "Video was modified since it was retrieved", nil)
+		return
+	}
+
+	body := map[string]json.RawMessage{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Body must be a JSON object", err)
+		return
+	}
+
+	patch := videoPatch{}
+	for field, value := range body {
+		// A null value removes the field, which only the description allows.
+		isNull := bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+		text := ""
+		if !isNull {
+			err = json.Unmarshal(value, &text)
+		}
+		switch field {
+		case "title":
+			if isNull {
+				respondWithError(w, http.StatusBadRequest, "title can't be removed", nil)
+				return
+			}
+			patch.title = &text
+		case "description":
+			patch.description = &text
+		case "visibility":
+			if isNull {
+				respondWithError(w, http.StatusBadRequest, "visibility can't be removed", nil)
+				return
+			}
+			if err == nil && !database.ValidVideoVisibility(text) {
+				respondWithError(w, http.StatusBadRequest, "Visibility must be 'public', 'unlisted' or 'private'", nil)
+				return
+			}
+			patch.visibility = &text
+		default:
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s can't be updated", field), nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a string", field), err)
+			return
+		}
+	}
+
+	// Fields the patch leaves alone were validated when they were set.
+	patched := patch.apply(video)
+	err = validateVideoMetadata(patched.Title, patched.Description)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if ifMatch != "" {
+		video, err = cfg.db.UpdateVideoIfUnmodified(patched)
+		if errors.Is(err, database.ErrVideoModified) {
+			respondWithError(w, http.StatusPreconditionFailed, "Video was modified since it was retrieved", err)
+			return
+		}
+	} else {
+		video, err = cfg.mergeVideoUpdate(video.ID, func(video database.Video) (database.Video, error) {
+			return patch.apply(video), nil
+		})
+		if errors.Is(err, errVideoDeleted) {
+			respondWithError(w, http.StatusNotFound, "Video not found", err)
+			return
+		}
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	if patch.visibility != nil {
+		video, err = cfg.moveVideoObjectsForResponse(r.Context(), video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't move video objects", err)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"1700000000000000000"`
+	tests := []struct {
+		ifMatch string
+		want    bool
+	}{
+		{ifMatch: etag, want: true},
+		{ifMatch: "*", want: true},
+		{ifMatch: `"1", ` + etag, want: true},
+		{ifMatch: ` ` + etag + ` `, want: true},
+		{ifMatch: `"1"`, want: false},
+		{ifMatch: `W/` + etag, want: false},
+		{ifMatch: `1700000000000000000`, want: false},
+		{ifMatch: ``, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifMatch, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifMatch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoVisibilityUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Visibility string `json:"visibility"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !database.ValidVideoVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be 'public', 'unlisted' or 'private'", nil)
+		return
+	}
+
+	video, err = cfg.mergeVideoUpdate(video.ID, func(video database.Video) (database.Video, error) {
+		video.Visibility = params.Visibility
+		return video, nil
+	})
+	if errors.Is(err, errVideoDeleted) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	// Also run when the visibility is unchanged, so a failed move can be
+	// retried by setting it again.
+	video, err = cfg.moveVideoObjectsForResponse(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move video objects", err)
+		return
+	}
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
+}
+
+func (cfg *apiConfig) handlerVideoViewersGet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	viewers, err := cfg.db.GetVideoViewers(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve viewers", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, viewers)
+}
+
+func (cfg *apiConfig) handlerVideoViewerAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+	if user.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+
+	err = cfg.db.AddVideoViewer(video.ID, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add viewer", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerVideoViewerRemove(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	err = cfg.db.RemoveVideoViewer(video.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove viewer", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) authorizeVideoOwner(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "401 Unauthorized", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// requestUserID returns the caller's user ID for endpoints that also serve
+// anonymous requests. A token that is present but invalid is an error.
+func (cfg *apiConfig) requestUserID(r *http.Request) (uuid.UUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, nil
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return auth.ValidateJWT(token, cfg.jwtSecret)
+}
+
+// canViewVideo reports whether userID may watch the video. userID is
+// uuid.Nil for anonymous requests.
+func (cfg *apiConfig) canViewVideo(video database.Video, userID uuid.UUID) (bool, error) {
+	if video.Visibility != database.VideoVisibilityPrivate {
+		return true, nil
+	}
+	if userID == uuid.Nil {
+		return false, nil
+	}
+	if video.UserID == userID {
+		return true, nil
+	}
+	return cfg.db.IsVideoViewer(video.ID, userID)
+}
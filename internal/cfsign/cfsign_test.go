@@ -0,0 +1,94 @@
+package cfsign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyDocument(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string
+	}{
+		{
+			name:   "expiry only",
+			policy: Policy{Resource: "https://cdn.example.com/private/*", Expires: expires},
+			want:   `{"Statement":[{"Resource":"https://cdn.example.com/private/*","Condition":{"DateLessThan":{"AWS:EpochTime":1700000000}}}]}`,
+		},
+		{
+			name:   "IP range",
+			policy: Policy{Resource: "https://cdn.example.com/a.mp4", Expires: expires, IPRange: "203.0.113.7/32"},
+			want:   `{"Statement":[{"Resource":"https://cdn.example.com/a.mp4","Condition":{"DateLessThan":{"AWS:EpochTime":1700000000},"IpAddress":{"AWS:SourceIp":"203.0.113.7/32"}}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.document()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("document() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewSigner("K2JCJMDEHXQW5F", key)
+	policy := Policy{Resource: "https://cdn.example.com/private/*", Expires: time.Unix(1700000000, 0)}
+
+	signed, err := signer.SignURL("https://cdn.example.com/private/a.mp4?v=1", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("v") != "1" {
+		t.Errorf("SignURL dropped the existing query: %s", signed)
+	}
+	if query.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" {
+		t.Errorf("Key-Pair-Id = %q, want %q", query.Get("Key-Pair-Id"), "K2JCJMDEHXQW5F")
+	}
+
+	document := decode(t, query.Get("Policy"))
+	want, err := policy.document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(document) != string(want) {
+		t.Fatalf("Policy = %s, want %s", document, want)
+	}
+	digest := sha1.Sum(document)
+	err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], decode(t, query.Get("Signature")))
+	if err != nil {
+		t.Fatalf("Signature doesn't verify: %v", err)
+	}
+}
+
+// decode reverses CloudFront's URL safe base64.
+func decode(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(value))
+	if err != nil {
+		t.Fatalf("couldn't decode %q: %v", value, err)
+	}
+	return data
+}
@@ -9,6 +9,8 @@ import (
 
 type Client struct {
 	db *sql.DB
+	// searchEnabled is false when SQLite was built without FTS5.
+	searchEnabled bool
 }
 
 func NewClient(pathToDB string) (Client, error) {
@@ -16,7 +18,10 @@ func NewClient(pathToDB string) (Client, error) {
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
+	// SQLite allows a single writer; funnel the handlers and the background
+	// workers through one connection instead of failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	c := Client{db: db}
 	err = c.autoMigrate()
 	if err != nil {
 		return Client{}, err
@@ -72,10 +77,290 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	err = c.addColumn("videos", "thumbnail_srcset", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "processing_status", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "hls_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "dash_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "sprite_vtt_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "sprite_sheet_urls", "TEXT")
+	if err != nil {
+		return err
+	}
+	mediaColumns := []struct{ name, definition string }{
+		{"duration_seconds", "REAL"},
+		{"width", "INTEGER"},
+		{"height", "INTEGER"},
+		{"aspect_ratio", "TEXT"},
+		{"video_codec", "TEXT"},
+		{"bitrate", "INTEGER"},
+		{"frame_rate", "REAL"},
+		{"rotation", "INTEGER"},
+		{"audio_channels", "INTEGER"},
+		{"container_format", "TEXT"},
+	}
+	for _, column := range mediaColumns {
+		err = c.addColumn("videos", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.addColumn("videos", "visibility", "TEXT NOT NULL DEFAULT 'public'")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "current_version", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "view_count", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "size_bytes", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "thumbnail_size_bytes", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "deleted_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+
+	videoViewerTable := `
+	CREATE TABLE IF NOT EXISTS video_viewers (
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, user_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(videoViewerTable)
+	if err != nil {
+		return err
+	}
+
+	uploadSessionTable := `
+	CREATE TABLE IF NOT EXISTS upload_sessions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		total_size INTEGER NOT NULL,
+		chunk_size INTEGER NOT NULL,
+		completed_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(uploadSessionTable)
+	if err != nil {
+		return err
+	}
+
+	uploadChunkTable := `
+	CREATE TABLE IF NOT EXISTS upload_chunks (
+		session_id TEXT NOT NULL,
+		chunk_index INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		chunk_offset INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		PRIMARY KEY(session_id, chunk_index),
+		FOREIGN KEY(session_id) REFERENCES upload_sessions(id)
+	);
+	`
+	_, err = c.db.Exec(uploadChunkTable)
+	if err != nil {
+		return err
+	}
+
+	videoJobTable := `
+	CREATE TABLE IF NOT EXISTS video_jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		raw_key TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		run_after TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoJobTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("video_jobs", "size_bytes", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	storageDeletionTable := `
+	CREATE TABLE IF NOT EXISTS storage_deletions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		is_prefix BOOLEAN NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		run_after TIMESTAMP NOT NULL
+	);
+	`
+	_, err = c.db.Exec(storageDeletionTable)
+	if err != nil {
+		return err
+	}
+
+	videoVersionTable := `
+	CREATE TABLE IF NOT EXISTS video_versions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		video_url TEXT,
+		hls_url TEXT,
+		dash_url TEXT,
+		sprite_vtt_url TEXT,
+		sprite_sheet_urls TEXT,
+		duration_seconds REAL,
+		width INTEGER,
+		height INTEGER,
+		aspect_ratio TEXT,
+		video_codec TEXT,
+		bitrate INTEGER,
+		frame_rate REAL,
+		rotation INTEGER,
+		audio_channels INTEGER,
+		container_format TEXT,
+		UNIQUE(video_id, version),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoVersionTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("video_versions", "size_bytes", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	quotaPlanTable := `
+	CREATE TABLE IF NOT EXISTS quota_plans (
+		name TEXT PRIMARY KEY,
+		max_total_bytes INTEGER NOT NULL,
+		max_videos INTEGER NOT NULL,
+		max_file_bytes INTEGER NOT NULL,
+		max_duration_seconds REAL NOT NULL
+	);
+	`
+	_, err = c.db.Exec(quotaPlanTable)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`
+	INSERT OR IGNORE INTO quota_plans (name, max_total_bytes, max_videos, max_file_bytes, max_duration_seconds)
+	VALUES (?, ?, ?, ?, ?)
+	`, DefaultQuotaPlan, int64(10<<30), 100, int64(1<<30), 2*60*60)
+	if err != nil {
+		return err
+	}
+
+	userQuotaTable := `
+	CREATE TABLE IF NOT EXISTS user_quotas (
+		user_id TEXT PRIMARY KEY,
+		plan TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(plan) REFERENCES quota_plans(name)
+	);
+	`
+	_, err = c.db.Exec(userQuotaTable)
+	if err != nil {
+		return err
+	}
+
+	return c.migrateVideoSearch()
+}
+
+// addColumn adds a column to a table created by an earlier version of
+// autoMigrate. CREATE TABLE IF NOT EXISTS leaves existing tables untouched.
+func (c *Client) addColumn(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
 }
 
 func (c Client) Reset() error {
+	if _, err := c.db.Exec("DELETE FROM user_quotas"); err != nil {
+		return fmt.Errorf("failed to reset table user_quotas: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_versions"); err != nil {
+		return fmt.Errorf("failed to reset table video_versions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM storage_deletions"); err != nil {
+		return fmt.Errorf("failed to reset table storage_deletions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_viewers"); err != nil {
+		return fmt.Errorf("failed to reset table video_viewers: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_jobs"); err != nil {
+		return fmt.Errorf("failed to reset table video_jobs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM upload_chunks"); err != nil {
+		return fmt.Errorf("failed to reset table upload_chunks: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM upload_sessions"); err != nil {
+		return fmt.Errorf("failed to reset table upload_sessions: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+// DefaultQuotaPlan applies to every user without a row in user_quotas.
+const DefaultQuotaPlan = "default"
+
+type Quota struct {
+	Plan               string  `json:"plan"`
+	MaxTotalBytes      int64   `json:"max_total_bytes"`
+	MaxVideos          int     `json:"max_videos"`
+	MaxFileBytes       int64   `json:"max_file_bytes"`
+	MaxDurationSeconds float64 `json:"max_duration_seconds"`
+}
+
+type Usage struct {
+	TotalBytes int64 `json:"total_bytes"`
+	Videos     int   `json:"videos"`
+}
+
+func (c Client) GetUserQuota(userID uuid.UUID) (Quota, error) {
+	query := `
+	SELECT name, max_total_bytes, max_videos, max_file_bytes, max_duration_seconds
+	FROM quota_plans
+	WHERE name = COALESCE((SELECT plan FROM user_quotas WHERE user_id = ?), ?)
+	`
+	var quota Quota
+	err := c.db.QueryRow(query, userID, DefaultQuotaPlan).Scan(
+		&quota.Plan,
+		&quota.MaxTotalBytes,
+		&quota.MaxVideos,
+		&quota.MaxFileBytes,
+		&quota.MaxDurationSeconds,
+	)
+	return quota, err
+}
+
+// GetUserUsage adds up the user's current uploads and thumbnails, retained
+// previous versions, uploads still waiting to be processed, and the full
+// size of upload sessions that are still open.
+func (c Client) GetUserUsage(userID uuid.UUID) (Usage, error) {
+	query := `
+	SELECT
+		(SELECT COUNT(*) FROM videos WHERE user_id = ? AND deleted_at IS NULL),
+		(SELECT COALESCE(SUM(size_bytes + thumbnail_size_bytes), 0) FROM videos WHERE user_id = ?)
+		+ (SELECT COALESCE(SUM(video_versions.size_bytes), 0)
+			FROM video_versions
+			JOIN videos ON videos.id = video_versions.video_id
+			WHERE videos.user_id = ?
+			AND video_versions.version IS NOT videos.current_version)
+		+ (SELECT COALESCE(SUM(video_jobs.size_bytes), 0)
+			FROM video_jobs
+			JOIN videos ON videos.id = video_jobs.video_id
+			WHERE videos.user_id = ?
+			AND video_jobs.status IN (?, ?))
+		+ (SELECT COALESCE(SUM(total_size), 0)
+			FROM upload_sessions
+			WHERE user_id = ? AND completed_at IS NULL)
+	`
+	var usage Usage
+	err := c.db.QueryRow(query, userID, userID, userID, userID, VideoJobStatusQueued, VideoJobStatusProcessing, userID).Scan(
+		&usage.Videos,
+		&usage.TotalBytes,
+	)
+	return usage, err
+}
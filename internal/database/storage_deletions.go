@@ -0,0 +1,124 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StorageDeletion is a storage object, or every object under a prefix, that
+// still has to be deleted.
+type StorageDeletion struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	Key       string    `json:"key"`
+	IsPrefix  bool      `json:"is_prefix"`
+	Attempts  int       `json:"attempts"`
+	LastError *string   `json:"error"`
+	RunAfter  time.Time `json:"run_after"`
+}
+
+const storageDeletionColumns = `
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		object_key,
+		is_prefix,
+		attempts,
+		last_error,
+		run_after`
+
+func scanStorageDeletion(row rowScanner) (StorageDeletion, error) {
+	var deletion StorageDeletion
+	err := row.Scan(
+		&deletion.ID,
+		&deletion.CreatedAt,
+		&deletion.UpdatedAt,
+		&deletion.VideoID,
+		&deletion.Key,
+		&deletion.IsPrefix,
+		&deletion.Attempts,
+		&deletion.LastError,
+		&deletion.RunAfter,
+	)
+	return deletion, err
+}
+
+func (c Client) CreateStorageDeletion(videoID uuid.UUID, key string, isPrefix bool) (StorageDeletion, error) {
+	deletion := StorageDeletion{
+		ID:       uuid.New(),
+		VideoID:  videoID,
+		Key:      key,
+		IsPrefix: isPrefix,
+		RunAfter: time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO storage_deletions (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		object_key,
+		is_prefix,
+		run_after
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, deletion.ID, videoID, key, isPrefix, deletion.RunAfter)
+	if err != nil {
+		return StorageDeletion{}, err
+	}
+	return deletion, nil
+}
+
+// GetDueStorageDeletions returns up to limit deletions whose retry time has
+// passed, oldest first.
+func (c Client) GetDueStorageDeletions(limit int) ([]StorageDeletion, error) {
+	query := `
+	SELECT` + storageDeletionColumns + `
+	FROM storage_deletions
+	WHERE run_after <= ?
+	ORDER BY run_after
+	LIMIT ?
+	`
+	rows, err := c.db.Query(query, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletions := []StorageDeletion{}
+	for rows.Next() {
+		deletion, err := scanStorageDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, deletion)
+	}
+	return deletions, rows.Err()
+}
+
+func (c Client) RetryStorageDeletion(id uuid.UUID, deleteErr string, runAfter time.Time) error {
+	query := `
+	UPDATE storage_deletions
+	SET
+		attempts = attempts + 1,
+		last_error = ?,
+		run_after = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, deleteErr, runAfter.UTC(), id)
+	return err
+}
+
+func (c Client) DeleteStorageDeletion(id uuid.UUID) error {
+	query := `
+	DELETE FROM storage_deletions
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UploadSession struct {
+	ID          uuid.UUID     `json:"id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	CompletedAt *time.Time    `json:"completed_at"`
+	Chunks      []UploadChunk `json:"chunks"`
+	CreateUploadSessionParams
+}
+
+type CreateUploadSessionParams struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	TotalSize int64     `json:"total_size"`
+	ChunkSize int64     `json:"chunk_size"`
+}
+
+type UploadChunk struct {
+	Index  int   `json:"index"`
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+func (s UploadSession) ChunkCount() int {
+	return int((s.TotalSize + s.ChunkSize - 1) / s.ChunkSize)
+}
+
+func (c Client) CreateUploadSession(params CreateUploadSessionParams) (UploadSession, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO upload_sessions (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		total_size,
+		chunk_size
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.VideoID, params.UserID, params.TotalSize, params.ChunkSize)
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	return c.GetUploadSession(id)
+}
+
+func (c Client) GetUploadSession(id uuid.UUID) (UploadSession, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		completed_at,
+		video_id,
+		user_id,
+		total_size,
+		chunk_size
+	FROM upload_sessions
+	WHERE id = ?
+	`
+
+	var session UploadSession
+	err := c.db.QueryRow(query, id).Scan(
+		&session.ID,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+		&session.CompletedAt,
+		&session.VideoID,
+		&session.UserID,
+		&session.TotalSize,
+		&session.ChunkSize,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadSession{}, nil
+		}
+		return UploadSession{}, err
+	}
+
+	chunkQuery := `
+	SELECT chunk_index, chunk_offset, size
+	FROM upload_chunks
+	WHERE session_id = ?
+	ORDER BY chunk_index
+	`
+	rows, err := c.db.Query(chunkQuery, id)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	defer rows.Close()
+
+	session.Chunks = []UploadChunk{}
+	for rows.Next() {
+		var chunk UploadChunk
+		if err := rows.Scan(&chunk.Index, &chunk.Offset, &chunk.Size); err != nil {
+			return UploadSession{}, err
+		}
+		session.Chunks = append(session.Chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return UploadSession{}, err
+	}
+
+	return session, nil
+}
+
+var ErrUploadSessionCompleted = errors.New("upload session is already complete")
+
+// SaveUploadChunk records a chunk. It fails with ErrUploadSessionCompleted
+// once the session has been claimed by CompleteUploadSession.
+func (c Client) SaveUploadChunk(sessionID uuid.UUID, chunk UploadChunk) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+	UPDATE upload_sessions
+	SET updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND completed_at IS NULL
+	`, sessionID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrUploadSessionCompleted
+	}
+
+	query := `
+	INSERT INTO upload_chunks (
+		session_id,
+		chunk_index,
+		created_at,
+		chunk_offset,
+		size
+	) VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)
+	ON CONFLICT(session_id, chunk_index) DO UPDATE SET
+		created_at = CURRENT_TIMESTAMP,
+		chunk_offset = excluded.chunk_offset,
+		size = excluded.size
+	`
+	_, err = tx.Exec(query, sessionID, chunk.Index, chunk.Offset, chunk.Size)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CompleteUploadSession marks the session complete unless it already is,
+// and reports whether this call did. Only the caller that completed it may
+// use its chunks.
+func (c Client) CompleteUploadSession(id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE upload_sessions
+	SET
+		completed_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND completed_at IS NULL
+	`
+	result, err := c.db.Exec(query, id)
+	if err != nil {
+		return false, err
+	}
+	completed, err := result.RowsAffected()
+	return completed > 0, err
+}
+
+// ReopenUploadSession undoes CompleteUploadSession after the upload
+// couldn't be processed, so the client can retry.
+func (c Client) ReopenUploadSession(id uuid.UUID) error {
+	query := `
+	UPDATE upload_sessions
+	SET
+		completed_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// GetExpiredUploadSessions returns up to limit incomplete sessions that
+// haven't received a chunk since cutoff, oldest first. Their chunks aren't
+// loaded.
+func (c Client) GetExpiredUploadSessions(cutoff time.Time, limit int) ([]UploadSession, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		total_size,
+		chunk_size
+	FROM upload_sessions
+	WHERE completed_at IS NULL AND datetime(updated_at) < ?
+	ORDER BY datetime(updated_at)
+	LIMIT ?
+	`
+	rows, err := c.db.Query(query, cutoff.UTC().Format(sqliteTimestamp), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UploadSession{}
+	for rows.Next() {
+		var session UploadSession
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+			&session.VideoID,
+			&session.UserID,
+			&session.TotalSize,
+			&session.ChunkSize,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (c Client) DeleteUploadSession(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM upload_chunks WHERE session_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM upload_sessions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	VideoJobStatusQueued     = "queued"
+	VideoJobStatusProcessing = "processing"
+	VideoJobStatusReady      = "ready"
+	VideoJobStatusFailed     = "failed"
+)
+
+type VideoJob struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	RawKey    string    `json:"-"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError *string   `json:"error"`
+	RunAfter  time.Time `json:"run_after"`
+}
+
+const videoJobColumns = `
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		raw_key,
+		status,
+		attempts,
+		last_error,
+		run_after`
+
+func scanVideoJob(row rowScanner) (VideoJob, error) {
+	var job VideoJob
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.VideoID,
+		&job.RawKey,
+		&job.Status,
+		&job.Attempts,
+		&job.LastError,
+		&job.RunAfter,
+	)
+	return job, err
+}
+
+func (c Client) CreateVideoJob(videoID uuid.UUID, rawKey string, sizeBytes int64) (VideoJob, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO video_jobs (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		raw_key,
+		status,
+		size_bytes,
+		run_after
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, videoID, rawKey, VideoJobStatusQueued, sizeBytes, time.Now().UTC())
+	if err != nil {
+		return VideoJob{}, err
+	}
+
+	return c.GetVideoJob(id)
+}
+
+func (c Client) GetVideoJob(id uuid.UUID) (VideoJob, error) {
+	query := `
+	SELECT` + videoJobColumns + `
+	FROM video_jobs
+	WHERE id = ?
+	`
+	job, err := scanVideoJob(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoJob{}, nil
+		}
+		return VideoJob{}, err
+	}
+	return job, nil
+}
+
+func (c Client) GetLatestVideoJob(videoID uuid.UUID) (VideoJob, error) {
+	query := `
+	SELECT` + videoJobColumns + `
+	FROM video_jobs
+	WHERE video_id = ?
+	ORDER BY created_at DESC, rowid DESC
+	LIMIT 1
+	`
+	job, err := scanVideoJob(c.db.QueryRow(query, videoID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoJob{}, nil
+		}
+		return VideoJob{}, err
+	}
+	return job, nil
+}
+
+// ClaimVideoJob marks the oldest runnable queued job as processing and
+// returns it. ok is false when there is nothing to do.
+func (c Client) ClaimVideoJob() (job VideoJob, ok bool, err error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return VideoJob{}, false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT` + videoJobColumns + `
+	FROM video_jobs
+	WHERE status = ? AND run_after <= ?
+	ORDER BY run_after, created_at
+	LIMIT 1
+	`
+	job, err = scanVideoJob(tx.QueryRow(query, VideoJobStatusQueued, time.Now().UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoJob{}, false, nil
+		}
+		return VideoJob{}, false, err
+	}
+
+	update := `
+	UPDATE video_jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ?
+	`
+	result, err := tx.Exec(update, VideoJobStatusProcessing, job.ID, VideoJobStatusQueued)
+	if err != nil {
+		return VideoJob{}, false, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return VideoJob{}, false, err
+	}
+	if claimed == 0 {
+		return VideoJob{}, false, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return VideoJob{}, false, err
+	}
+
+	job.Status = VideoJobStatusProcessing
+	job.Attempts++
+	return job, true, nil
+}
+
+func (c Client) CompleteVideoJob(id uuid.UUID) error {
+	query := `
+	UPDATE video_jobs
+	SET
+		status = ?,
+		last_error = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, VideoJobStatusReady, id)
+	return err
+}
+
+// RetryVideoJob puts a job back in the queue to run again after runAfter.
+func (c Client) RetryVideoJob(id uuid.UUID, jobErr string, runAfter time.Time) error {
+	query := `
+	UPDATE video_jobs
+	SET
+		status = ?,
+		last_error = ?,
+		run_after = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, VideoJobStatusQueued, jobErr, runAfter.UTC(), id)
+	return err
+}
+
+func (c Client) FailVideoJob(id uuid.UUID, jobErr string) error {
+	query := `
+	UPDATE video_jobs
+	SET
+		status = ?,
+		last_error = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, VideoJobStatusFailed, jobErr, id)
+	return err
+}
+
+// RequeueProcessingVideoJobs returns jobs that were interrupted by a restart
+// to the queue.
+func (c Client) RequeueProcessingVideoJobs() error {
+	query := `
+	UPDATE video_jobs
+	SET
+		status = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE status = ?
+	`
+	_, err := c.db.Exec(query, VideoJobStatusQueued, VideoJobStatusProcessing)
+	return err
+}
+
+// GetPendingRawKeys returns the raw uploads of jobs that haven't finished,
+// including failed ones kept for inspection.
+func (c Client) GetPendingRawKeys() ([]string, error) {
+	query := `
+	SELECT raw_key
+	FROM video_jobs
+	WHERE status != ?
+	`
+	rows, err := c.db.Query(query, VideoJobStatusReady)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		err := rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
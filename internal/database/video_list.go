@@ -0,0 +1,275 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	VideoSortNewest     = "newest"
+	VideoSortOldest     = "oldest"
+	VideoSortTitle      = "title"
+	VideoSortMostViewed = "most_viewed"
+	// VideoSortDeleted lists the trash, most recently deleted first.
+	VideoSortDeleted = "deleted"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sqliteTimestamp is the layout CURRENT_TIMESTAMP writes; created_at is
+// compared through datetime() in this form.
+const sqliteTimestamp = "2006-01-02 15:04:05"
+
+// videoSort orders by columns, all in the same direction, ending with id so
+// that every row has a unique position to resume from.
+type videoSort struct {
+	columns    []string
+	descending bool
+	values     func(Video) []any
+}
+
+var videoSorts = map[string]videoSort{
+	VideoSortNewest: {
+		columns:    []string{"datetime(created_at)", "id"},
+		descending: true,
+		values: func(v Video) []any {
+			return []any{v.CreatedAt.UTC().Format(sqliteTimestamp), v.ID.String()}
+		},
+	},
+	VideoSortOldest: {
+		columns: []string{"datetime(created_at)", "id"},
+		values: func(v Video) []any {
+			return []any{v.CreatedAt.UTC().Format(sqliteTimestamp), v.ID.String()}
+		},
+	},
+	VideoSortTitle: {
+		columns: []string{"title COLLATE NOCASE", "id"},
+		values: func(v Video) []any {
+			return []any{v.Title, v.ID.String()}
+		},
+	},
+	VideoSortMostViewed: {
+		columns:    []string{"view_count", "datetime(created_at)", "id"},
+		descending: true,
+		values: func(v Video) []any {
+			return []any{v.ViewCount, v.CreatedAt.UTC().Format(sqliteTimestamp), v.ID.String()}
+		},
+	},
+	VideoSortDeleted: {
+		columns:    []string{"datetime(deleted_at)", "id"},
+		descending: true,
+		values: func(v Video) []any {
+			var deletedAt any
+			if v.DeletedAt != nil {
+				deletedAt = v.DeletedAt.UTC().Format(sqliteTimestamp)
+			}
+			return []any{deletedAt, v.ID.String()}
+		},
+	},
+}
+
+func ValidVideoSort(sort string) bool {
+	_, ok := videoSorts[sort]
+	return ok
+}
+
+type ListVideosParams struct {
+	// UserID limits the list to one user's videos when set.
+	UserID uuid.UUID
+	// Public limits the list to public videos that finished processing.
+	Public bool
+	// Trashed lists videos in the trash instead of the others.
+	Trashed bool
+
+	TitleContains string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	HasVideo      *bool
+	HasThumbnail  *bool
+	AspectRatio   string
+	Status        string
+
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+type videoCursor struct {
+	Sort   string `json:"s"`
+	Values []any  `json:"v"`
+}
+
+func encodeVideoCursor(sort string, values []any) (string, error) {
+	data, err := json.Marshal(videoCursor{Sort: sort, Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeVideoCursor(sort, cursor string, numValues int) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var decoded videoCursor
+	err = json.Unmarshal(data, &decoded)
+	if err != nil || decoded.Sort != sort || len(decoded.Values) != numValues {
+		return nil, ErrInvalidCursor
+	}
+	return decoded.Values, nil
+}
+
+// publicVideoCondition matches public videos that have a playable upload,
+// including ones reprocessing a new upload. It takes VideoVisibilityPublic
+// as an argument.
+const publicVideoCondition = "(visibility = ? AND video_url IS NOT NULL)"
+
+// listVideosWhere builds the filter shared by ListVideos and CountVideos.
+// Videos in the trash are only included when params.Trashed is set.
+func listVideosWhere(params ListVideosParams) ([]string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	if params.Trashed {
+		conditions = []string{"deleted_at IS NOT NULL"}
+	}
+	args := []any{}
+	if params.UserID != uuid.Nil {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, params.UserID)
+	}
+	if params.Public {
+		conditions = append(conditions, publicVideoCondition)
+		args = append(args, VideoVisibilityPublic)
+	}
+	if params.TitleContains != "" {
+		conditions = append(conditions, `title LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(params.TitleContains)+"%")
+	}
+	if params.CreatedAfter != nil {
+		conditions = append(conditions, "datetime(created_at) >= ?")
+		args = append(args, params.CreatedAfter.UTC().Format(sqliteTimestamp))
+	}
+	if params.CreatedBefore != nil {
+		conditions = append(conditions, "datetime(created_at) < ?")
+		args = append(args, params.CreatedBefore.UTC().Format(sqliteTimestamp))
+	}
+	if params.HasVideo != nil {
+		if *params.HasVideo {
+			conditions = append(conditions, "video_url IS NOT NULL")
+		} else {
+			conditions = append(conditions, "video_url IS NULL")
+		}
+	}
+	if params.HasThumbnail != nil {
+		if *params.HasThumbnail {
+			conditions = append(conditions, "thumbnail_url IS NOT NULL")
+		} else {
+			conditions = append(conditions, "thumbnail_url IS NULL")
+		}
+	}
+	if params.AspectRatio != "" {
+		conditions = append(conditions, "aspect_ratio = ?")
+		args = append(args, params.AspectRatio)
+	}
+	if params.Status != "" {
+		// Videos processed before the job queue have a URL but no status.
+		if params.Status == VideoJobStatusReady {
+			conditions = append(conditions, "(processing_status = ? OR (processing_status IS NULL AND video_url IS NOT NULL))")
+		} else {
+			conditions = append(conditions, "processing_status = ?")
+		}
+		args = append(args, params.Status)
+	}
+	return conditions, args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return `
+	WHERE ` + strings.Join(conditions, " AND ")
+}
+
+// CountVideos counts the videos matching params' filters, ignoring the
+// cursor and limit.
+func (c Client) CountVideos(params ListVideosParams) (int, error) {
+	conditions, args := listVideosWhere(params)
+	query := `
+	SELECT COUNT(*)
+	FROM videos` + whereClause(conditions)
+
+	var count int
+	err := c.db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// ListVideos returns one page of videos and the cursor of the next page,
+// which is empty on the last one.
+func (c Client) ListVideos(params ListVideosParams) ([]Video, string, error) {
+	sort, ok := videoSorts[params.Sort]
+	if !ok {
+		return nil, "", errors.New("unknown sort " + params.Sort)
+	}
+
+	conditions, args := listVideosWhere(params)
+	comparison := ">"
+	direction := "ASC"
+	if sort.descending {
+		comparison = "<"
+		direction = "DESC"
+	}
+	if params.Cursor != "" {
+		values, err := decodeVideoCursor(params.Sort, params.Cursor, len(sort.columns))
+		if err != nil {
+			return nil, "", err
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		conditions = append(conditions, "("+strings.Join(sort.columns, ", ")+") "+comparison+" ("+placeholders+")")
+		args = append(args, values...)
+	}
+
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos` + whereClause(conditions) + `
+	ORDER BY ` + strings.Join(sort.columns, " "+direction+", ") + " " + direction + `
+	LIMIT ?
+	`
+	// Fetch one extra row to learn whether there is a next page.
+	args = append(args, params.Limit+1)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(videos) <= params.Limit {
+		return videos, "", nil
+	}
+	videos = videos[:params.Limit]
+	nextCursor, err := encodeVideoCursor(params.Sort, sort.values(videos[len(videos)-1]))
+	if err != nil {
+		return nil, "", err
+	}
+	return videos, nextCursor, nil
+}
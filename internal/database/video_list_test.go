@@ -0,0 +1,43 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestVideoCursor(t *testing.T) {
+	values := []any{"2024-05-01 10:00:00", 42.0, "0b6f3a3c-2c55-4a4e-9d8e-8f3a1c1d2e3f"}
+	cursor, err := encodeVideoCursor(VideoSortMostViewed, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		sort      string
+		cursor    string
+		numValues int
+		want      []any
+		err       error
+	}{
+		{name: "round trip", sort: VideoSortMostViewed, cursor: cursor, numValues: 3, want: values},
+		{name: "other sort", sort: VideoSortNewest, cursor: cursor, numValues: 3, err: ErrInvalidCursor},
+		{name: "wrong value count", sort: VideoSortMostViewed, cursor: cursor, numValues: 2, err: ErrInvalidCursor},
+		{name: "not base64", sort: VideoSortMostViewed, cursor: "not a cursor!", numValues: 3, err: ErrInvalidCursor},
+		{name: "not JSON", sort: VideoSortMostViewed, cursor: base64.RawURLEncoding.EncodeToString([]byte("{")), numValues: 3, err: ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeVideoCursor(tt.sort, tt.cursor, tt.numValues)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("decodeVideoCursor() error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decodeVideoCursor() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
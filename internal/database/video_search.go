@@ -0,0 +1,311 @@
+package database
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidSearchQuery = errors.New("search query has no terms")
+
+// searchCursorSort tags search cursors so they can't be mixed up with
+// ListVideos cursors.
+const searchCursorSort = "relevance"
+
+// Highlighted terms are wrapped in these control characters by SQLite and
+// turned into <mark> tags once the rest of the text has been escaped.
+const (
+	highlightOpen  = "\x02"
+	highlightClose = "\x03"
+)
+
+// migrateVideoSearch indexes video titles and descriptions in the videos_fts
+// FTS5 table, kept in sync by triggers. The index is rebuilt whenever the
+// triggers are missing, so videos written by a build without FTS5 are picked
+// up once it becomes available again.
+func (c *Client) migrateVideoSearch() error {
+	var enabled bool
+	err := c.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		// The triggers would make every write to videos fail.
+		for _, trigger := range []string{"videos_fts_insert", "videos_fts_update", "videos_fts_delete"} {
+			_, err = c.db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var triggers int
+	err = c.db.QueryRow(`
+	SELECT COUNT(*)
+	FROM sqlite_master
+	WHERE type = 'trigger' AND name IN ('videos_fts_insert', 'videos_fts_update', 'videos_fts_delete')
+	`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	if triggers == 3 {
+		c.searchEnabled = true
+		return nil
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`
+		CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(
+			video_id UNINDEXED,
+			title,
+			description,
+			prefix = '2 3'
+		)
+		`,
+		"DELETE FROM videos_fts",
+		"INSERT INTO videos_fts (video_id, title, description) SELECT id, title, description FROM videos",
+		`
+		CREATE TRIGGER IF NOT EXISTS videos_fts_insert AFTER INSERT ON videos BEGIN
+			INSERT INTO videos_fts (video_id, title, description) VALUES (new.id, new.title, new.description);
+		END
+		`,
+		`
+		CREATE TRIGGER IF NOT EXISTS videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+			DELETE FROM videos_fts WHERE video_id = old.id;
+			INSERT INTO videos_fts (video_id, title, description) VALUES (new.id, new.title, new.description);
+		END
+		`,
+		`
+		CREATE TRIGGER IF NOT EXISTS videos_fts_delete AFTER DELETE ON videos BEGIN
+			DELETE FROM videos_fts WHERE video_id = old.id;
+		END
+		`,
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	c.searchEnabled = true
+	return nil
+}
+
+// SearchEnabled reports whether SQLite was built with FTS5. SearchVideos
+// fails when it wasn't.
+func (c Client) SearchEnabled() bool {
+	return c.searchEnabled
+}
+
+type SearchVideosParams struct {
+	Query string
+	// UserID is the caller, whose own videos are searched along with public
+	// ones. It is uuid.Nil for anonymous searches.
+	UserID uuid.UUID
+
+	Cursor string
+	Limit  int
+}
+
+type SearchResult struct {
+	Video
+	// TitleHighlight and DescriptionSnippet are HTML-escaped, with matching
+	// terms wrapped in <mark> tags.
+	TitleHighlight     string `json:"title_highlight"`
+	DescriptionSnippet string `json:"description_snippet"`
+
+	score float64
+}
+
+// searchMatch turns user input into an FTS5 query matching every term.
+// Double-quoted text is matched as a phrase and a trailing * on a word or
+// phrase makes it a prefix query. All other FTS5 syntax is treated as text.
+func searchMatch(query string) (string, error) {
+	terms := []string{}
+	addTerm := func(text string, prefix bool) {
+		text = strings.TrimSpace(text)
+		if strings.IndexFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) < 0 {
+			return
+		}
+		term := `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	for {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		if query == "" {
+			break
+		}
+		var text string
+		if query[0] == '"' {
+			end := strings.IndexByte(query[1:], '"')
+			if end < 0 {
+				// Unterminated phrases run to the end of the query.
+				text, query = query[1:], ""
+			} else {
+				text, query = query[1:end+1], query[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(query)
+			}
+			text, query = query[:end], query[end:]
+			if strings.HasSuffix(text, "*") {
+				text, query = strings.TrimSuffix(text, "*"), "*"+query
+			}
+		}
+		prefix := strings.HasPrefix(query, "*")
+		if prefix {
+			query = query[1:]
+		}
+		addTerm(text, prefix)
+	}
+
+	if len(terms) == 0 {
+		return "", ErrInvalidSearchQuery
+	}
+	return strings.Join(terms, " "), nil
+}
+
+func searchHighlightHTML(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, highlightOpen, "<mark>")
+	return strings.ReplaceAll(text, highlightClose, "</mark>")
+}
+
+// searchVideosWhere limits search results to public videos and the caller's
+// own.
+func searchVideosWhere(params SearchVideosParams) ([]string, []any) {
+	args := []any{VideoVisibilityPublic}
+	condition := publicVideoCondition
+	if params.UserID != uuid.Nil {
+		condition = "(" + condition + " OR user_id = ?)"
+		args = append(args, params.UserID)
+	}
+	return []string{"deleted_at IS NULL", condition}, args
+}
+
+// CountSearchResults counts the videos matching params, ignoring the cursor
+// and limit.
+func (c Client) CountSearchResults(params SearchVideosParams) (int, error) {
+	match, err := searchMatch(params.Query)
+	if err != nil {
+		return 0, err
+	}
+	conditions, args := searchVideosWhere(params)
+	query := `
+	SELECT COUNT(*)
+	FROM videos
+	JOIN (
+		SELECT video_id FROM videos_fts WHERE videos_fts MATCH ?
+	) AS matches ON matches.video_id = videos.id` + whereClause(conditions)
+
+	var count int
+	err = c.db.QueryRow(query, append([]any{match}, args...)...).Scan(&count)
+	return count, err
+}
+
+// SearchVideos returns one page of videos matching params.Query, best match
+// first, and the cursor of the next page, which is empty on the last one.
+// Titles weigh ten times as much as descriptions in the ranking.
+func (c Client) SearchVideos(params SearchVideosParams) ([]SearchResult, string, error) {
+	match, err := searchMatch(params.Query)
+	if err != nil {
+		return nil, "", err
+	}
+	conditions, args := searchVideosWhere(params)
+	args = append([]any{match}, args...)
+	if params.Cursor != "" {
+		values, err := decodeVideoCursor(searchCursorSort, params.Cursor, 2)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, "(matches.score, videos.id) > (?, ?)")
+		args = append(args, values...)
+	}
+
+	query := `
+	SELECT` + videoColumns + `,
+		matches.title_highlight,
+		matches.description_snippet,
+		matches.score
+	FROM videos
+	JOIN (
+		SELECT
+			video_id,
+			highlight(videos_fts, 1, char(2), char(3)) AS title_highlight,
+			COALESCE(snippet(videos_fts, 2, char(2), char(3), '…', 24), '') AS description_snippet,
+			bm25(videos_fts, 0.0, 10.0, 1.0) AS score
+		FROM videos_fts
+		WHERE videos_fts MATCH ?
+	) AS matches ON matches.video_id = videos.id` + whereClause(conditions) + `
+	ORDER BY matches.score ASC, videos.id ASC
+	LIMIT ?
+	`
+	// Fetch one extra row to learn whether there is a next page.
+	args = append(args, params.Limit+1)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		result.Video, err = scanVideo(searchResultScanner{rows, &result})
+		if err != nil {
+			return nil, "", err
+		}
+		result.TitleHighlight = searchHighlightHTML(result.TitleHighlight)
+		result.DescriptionSnippet = searchHighlightHTML(result.DescriptionSnippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(results) <= params.Limit {
+		return results, "", nil
+	}
+	results = results[:params.Limit]
+	last := results[len(results)-1]
+	nextCursor, err := encodeVideoCursor(searchCursorSort, []any{last.score, last.ID.String()})
+	if err != nil {
+		return nil, "", err
+	}
+	return results, nextCursor, nil
+}
+
+// searchResultScanner scans the columns following videoColumns into result.
+type searchResultScanner struct {
+	rowScanner
+	result *SearchResult
+}
+
+func (s searchResultScanner) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append(dest,
+		&s.result.TitleHighlight,
+		&s.result.DescriptionSnippet,
+		&s.result.score,
+	)...)
+}
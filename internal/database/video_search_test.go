@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestSearchMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+		err   error
+	}{
+		{name: "words", query: "good dog", want: `"good" "dog"`},
+		{name: "OR is a word", query: "cats OR dogs", want: `"cats" "OR" "dogs"`},
+		{name: "NEAR is a word", query: "NEAR(cat dog)", want: `"NEAR(cat" "dog)"`},
+		{name: "column filter is a word", query: "title:secret", want: `"title:secret"`},
+		{name: "operators are text", query: "-cat ^dog", want: `"-cat" "^dog"`},
+		{name: "phrase", query: `"good boy" walks`, want: `"good boy" "walks"`},
+		{name: "unbalanced quote runs to the end", query: `walks "good boy`, want: `"walks" "good boy"`},
+		{name: "quote inside a word", query: `a"b`, want: `"a" "b"`},
+		{name: "prefix", query: "train*", want: `"train"*`},
+		{name: "phrase prefix", query: `"good bo"*`, want: `"good bo"*`},
+		{name: "bare star is dropped", query: "dog *", want: `"dog"`},
+		{name: "bare star", query: "*", err: ErrInvalidSearchQuery},
+		{name: "empty phrase", query: `""`, err: ErrInvalidSearchQuery},
+		{name: "punctuation only", query: "- ( )", err: ErrInvalidSearchQuery},
+		{name: "empty", query: "  ", err: ErrInvalidSearchQuery},
+	}
+
+	// With FTS5 compiled in, also check that SQLite accepts every query.
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE VIRTUAL TABLE fts USING fts5(title)")
+	fts5 := err == nil
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := searchMatch(tt.query)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("searchMatch(%q) error = %v, want %v", tt.query, err, tt.err)
+			}
+			if got != tt.want {
+				t.Fatalf("searchMatch(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+			if fts5 && err == nil {
+				_, err := db.Exec("SELECT * FROM fts WHERE fts MATCH ?", got)
+				if err != nil {
+					t.Errorf("FTS5 rejected %q: %v", got, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GetVideoIncludingTrashed is GetVideo, but also returns videos in the
+// trash.
+func (c Client) GetVideoIncludingTrashed(id uuid.UUID) (Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id = ?
+	`
+
+	video, err := scanVideo(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Video{}, nil
+		}
+		return Video{}, err
+	}
+
+	return video, nil
+}
+
+// TrashVideo moves a video to the trash, hiding it until it's restored or
+// purged.
+func (c Client) TrashVideo(id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = CURRENT_TIMESTAMP, updated_at = ?
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err := c.db.Exec(query, time.Now().UTC(), id)
+	return err
+}
+
+func (c Client) RestoreVideo(id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL, updated_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, time.Now().UTC(), id)
+	return err
+}
+
+// GetVideosTrashedBefore returns up to limit videos that were moved to the
+// trash before cutoff, oldest first.
+func (c Client) GetVideosTrashedBefore(cutoff time.Time, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND datetime(deleted_at) < ?
+	ORDER BY datetime(deleted_at)
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, cutoff.UTC().Format(sqliteTimestamp), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+// DeleteTrashedVideo permanently deletes a video that was moved to the
+// trash before cutoff, along with its views, jobs, versions and upload
+// sessions. It reports false, deleting nothing, if the video was restored
+// or is already gone.
+func (c Client) DeleteTrashedVideo(id uuid.UUID, cutoff time.Time) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM videos
+	WHERE id = ? AND deleted_at IS NOT NULL AND datetime(deleted_at) < ?
+	`
+	result, err := tx.Exec(query, id, cutoff.UTC().Format(sqliteTimestamp))
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+
+	dependents := []string{
+		"DELETE FROM video_viewers WHERE video_id = ?",
+		"DELETE FROM video_jobs WHERE video_id = ?",
+		"DELETE FROM video_versions WHERE video_id = ?",
+		"DELETE FROM upload_chunks WHERE session_id IN (SELECT id FROM upload_sessions WHERE video_id = ?)",
+		"DELETE FROM upload_sessions WHERE video_id = ?",
+	}
+	for _, query := range dependents {
+		_, err := tx.Exec(query, id)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
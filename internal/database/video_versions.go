@@ -0,0 +1,238 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoVersion is one processed upload of a video: its renditions and the
+// metadata probed from it.
+type VideoVersion struct {
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	VideoID         uuid.UUID  `json:"video_id"`
+	Version         int        `json:"version"`
+	VideoURL        *string    `json:"video_url"`
+	HLSURL          *string    `json:"hls_url"`
+	DASHURL         *string    `json:"dash_url"`
+	SpriteVTTURL    *string    `json:"sprite_vtt_url"`
+	SpriteSheetURLs StringList `json:"sprite_sheet_urls"`
+	SizeBytes       int64      `json:"size_bytes"`
+	MediaInfo
+}
+
+// Apply makes the version the current one of video.
+func (v VideoVersion) Apply(video Video) Video {
+	video.VideoURL = v.VideoURL
+	video.HLSURL = v.HLSURL
+	video.DASHURL = v.DASHURL
+	video.SpriteVTTURL = v.SpriteVTTURL
+	video.SpriteSheetURLs = v.SpriteSheetURLs
+	video.SizeBytes = v.SizeBytes
+	video.MediaInfo = v.MediaInfo
+	version := v.Version
+	video.CurrentVersion = &version
+	return video
+}
+
+const videoVersionColumns = `
+		id,
+		created_at,
+		video_id,
+		version,
+		video_url,
+		hls_url,
+		dash_url,
+		sprite_vtt_url,
+		sprite_sheet_urls,
+		size_bytes,
+		duration_seconds,
+		width,
+		height,
+		aspect_ratio,
+		video_codec,
+		bitrate,
+		frame_rate,
+		rotation,
+		audio_channels,
+		container_format`
+
+func scanVideoVersion(row rowScanner) (VideoVersion, error) {
+	var version VideoVersion
+	err := row.Scan(
+		&version.ID,
+		&version.CreatedAt,
+		&version.VideoID,
+		&version.Version,
+		&version.VideoURL,
+		&version.HLSURL,
+		&version.DASHURL,
+		&version.SpriteVTTURL,
+		&version.SpriteSheetURLs,
+		&version.SizeBytes,
+		&version.DurationSeconds,
+		&version.Width,
+		&version.Height,
+		&version.AspectRatio,
+		&version.VideoCodec,
+		&version.Bitrate,
+		&version.FrameRate,
+		&version.Rotation,
+		&version.AudioChannels,
+		&version.ContainerFormat,
+	)
+	return version, err
+}
+
+// CreateVideoVersion records the video's current renditions as its next
+// version.
+func (c Client) CreateVideoVersion(video Video) (VideoVersion, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO video_versions (
+		id,
+		created_at,
+		video_id,
+		version,
+		video_url,
+		hls_url,
+		dash_url,
+		sprite_vtt_url,
+		sprite_sheet_urls,
+		size_bytes,
+		duration_seconds,
+		width,
+		height,
+		aspect_ratio,
+		video_codec,
+		bitrate,
+		frame_rate,
+		rotation,
+		audio_channels,
+		container_format
+	) VALUES (
+		?,
+		CURRENT_TIMESTAMP,
+		?,
+		(SELECT COALESCE(MAX(version), 0) + 1 FROM video_versions WHERE video_id = ?),
+		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+	)
+	`
+	_, err := c.db.Exec(
+		query,
+		id,
+		video.ID,
+		video.ID,
+		video.VideoURL,
+		video.HLSURL,
+		video.DASHURL,
+		video.SpriteVTTURL,
+		video.SpriteSheetURLs,
+		video.SizeBytes,
+		video.DurationSeconds,
+		video.Width,
+		video.Height,
+		video.AspectRatio,
+		video.VideoCodec,
+		video.Bitrate,
+		video.FrameRate,
+		video.Rotation,
+		video.AudioChannels,
+		video.ContainerFormat,
+	)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	query = `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	WHERE id = ?
+	`
+	return scanVideoVersion(c.db.QueryRow(query, id))
+}
+
+func (c Client) GetVideoVersion(videoID uuid.UUID, version int) (VideoVersion, error) {
+	query := `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	WHERE video_id = ? AND version = ?
+	`
+	videoVersion, err := scanVideoVersion(c.db.QueryRow(query, videoID, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+	return videoVersion, nil
+}
+
+// GetVideoVersions returns the video's versions, newest first.
+func (c Client) GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	`
+	return c.queryVideoVersions(query, videoID)
+}
+
+func (c Client) GetAllVideoVersions() ([]VideoVersion, error) {
+	query := `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	ORDER BY video_id, version
+	`
+	return c.queryVideoVersions(query)
+}
+
+func (c Client) queryVideoVersions(query string, args ...any) ([]VideoVersion, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		version, err := scanVideoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func (c Client) DeleteVideoVersion(id uuid.UUID) error {
+	query := `
+	DELETE FROM video_versions
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// UpdateVideoVersionURLs rewrites the stored URLs of a version.
+func (c Client) UpdateVideoVersionURLs(version VideoVersion) error {
+	query := `
+	UPDATE video_versions
+	SET video_url = ?, hls_url = ?, dash_url = ?, sprite_vtt_url = ?, sprite_sheet_urls = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(
+		query,
+		version.VideoURL,
+		version.HLSURL,
+		version.DASHURL,
+		version.SpriteVTTURL,
+		version.SpriteSheetURLs,
+		version.ID,
+	)
+	return err
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoViewer struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c Client) AddVideoViewer(videoID, userID uuid.UUID) error {
+	query := `
+	INSERT INTO video_viewers (video_id, user_id, created_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(video_id, user_id) DO NOTHING
+	`
+	_, err := c.db.Exec(query, videoID, userID)
+	return err
+}
+
+func (c Client) RemoveVideoViewer(videoID, userID uuid.UUID) error {
+	query := `
+	DELETE FROM video_viewers
+	WHERE video_id = ? AND user_id = ?
+	`
+	_, err := c.db.Exec(query, videoID, userID)
+	return err
+}
+
+func (c Client) IsVideoViewer(videoID, userID uuid.UUID) (bool, error) {
+	query := `
+	SELECT 1
+	FROM video_viewers
+	WHERE video_id = ? AND user_id = ?
+	`
+	var found int
+	err := c.db.QueryRow(query, videoID, userID).Scan(&found)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c Client) GetVideoViewers(videoID uuid.UUID) ([]VideoViewer, error) {
+	query := `
+	SELECT video_viewers.video_id, video_viewers.user_id, users.email, video_viewers.created_at
+	FROM video_viewers
+	JOIN users ON users.id = video_viewers.user_id
+	WHERE video_viewers.video_id = ?
+	ORDER BY video_viewers.created_at
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	viewers := []VideoViewer{}
+	for rows.Next() {
+		var viewer VideoViewer
+		err := rows.Scan(&viewer.VideoID, &viewer.UserID, &viewer.Email, &viewer.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		viewers = append(viewers, viewer)
+	}
+	return viewers, rows.Err()
+}
@@ -9,37 +9,147 @@ import (
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID                 uuid.UUID  `json:"id"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	ThumbnailURL       *string    `json:"thumbnail_url"`
+	ThumbnailSrcset    StringMap  `json:"thumbnail_srcset"`
+	VideoURL           *string    `json:"video_url"`
+	HLSURL             *string    `json:"hls_url"`
+	DASHURL            *string    `json:"dash_url"`
+	SpriteVTTURL       *string    `json:"sprite_vtt_url"`
+	SpriteSheetURLs    StringList `json:"sprite_sheet_urls"`
+	ProcessingStatus   *string    `json:"processing_status"`
+	CurrentVersion     *int       `json:"version"`
+	ViewCount          int64      `json:"view_count"`
+	SizeBytes          int64      `json:"size_bytes"`
+	ThumbnailSizeBytes int64      `json:"thumbnail_size_bytes"`
+	DeletedAt          *time.Time `json:"deleted_at"`
+	MediaInfo
 	CreateVideoParams
 }
 
+// MediaInfo is the probed metadata of the uploaded video. The fields are nil
+// until processing finishes.
+type MediaInfo struct {
+	DurationSeconds *float64 `json:"duration_seconds"`
+	Width           *int     `json:"width"`
+	Height          *int     `json:"height"`
+	AspectRatio     *string  `json:"aspect_ratio"`
+	VideoCodec      *string  `json:"video_codec"`
+	Bitrate         *int64   `json:"bitrate"`
+	FrameRate       *float64 `json:"frame_rate"`
+	Rotation        *int     `json:"rotation"`
+	AudioChannels   *int     `json:"audio_channels"`
+	ContainerFormat *string  `json:"container_format"`
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
 	UserID      uuid.UUID `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+// Unlisted videos are reachable by anyone with the link but kept out of
+// listings. Private videos are only served to the owner and their viewers,
+// through short-lived signed URLs.
+const (
+	VideoVisibilityPublic   = "public"
+	VideoVisibilityUnlisted = "unlisted"
+	VideoVisibilityPrivate  = "private"
+)
+
+func ValidVideoVisibility(visibility string) bool {
+	switch visibility {
+	case VideoVisibilityPublic, VideoVisibilityUnlisted, VideoVisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
 		title,
 		description,
+		visibility,
 		thumbnail_url,
+		thumbnail_srcset,
 		video_url,
-		user_id
+		hls_url,
+		dash_url,
+		sprite_vtt_url,
+		sprite_sheet_urls,
+		processing_status,
+		current_version,
+		view_count,
+		size_bytes,
+		thumbnail_size_bytes,
+		deleted_at,
+		duration_seconds,
+		width,
+		height,
+		aspect_ratio,
+		video_codec,
+		bitrate,
+		frame_rate,
+		rotation,
+		audio_channels,
+		container_format,
+		user_id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.Visibility,
+		&video.ThumbnailURL,
+		&video.ThumbnailSrcset,
+		&video.VideoURL,
+		&video.HLSURL,
+		&video.DASHURL,
+		&video.SpriteVTTURL,
+		&video.SpriteSheetURLs,
+		&video.ProcessingStatus,
+		&video.CurrentVersion,
+		&video.ViewCount,
+		&video.SizeBytes,
+		&video.ThumbnailSizeBytes,
+		&video.DeletedAt,
+		&video.DurationSeconds,
+		&video.Width,
+		&video.Height,
+		&video.AspectRatio,
+		&video.VideoCodec,
+		&video.Bitrate,
+		&video.FrameRate,
+		&video.Rotation,
+		&video.AudioChannels,
+		&video.ContainerFormat,
+		&video.UserID,
+	)
+	return video, err
+}
+
+// GetAllVideos returns every video, including those in the trash.
+func (c Client) GetAllVideos() ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
+	ORDER BY created_at
 	`
 
-	rows, err := c.db.Query(query, userID)
+	rows, err := c.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -47,23 +157,14 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
-	return videos, nil
+	return videos, rows.Err()
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
@@ -75,10 +176,14 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
+		visibility,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPublic
+	}
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.Visibility, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
@@ -86,31 +191,15 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	return c.GetVideo(id)
 }
 
+// GetVideo returns the video unless it doesn't exist or is in the trash.
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE id = ?
+	WHERE id = ? AND deleted_at IS NULL
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -121,35 +210,131 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
-	query := `
+// ErrVideoModified is returned by UpdateVideoIfUnmodified when the video
+// changed or was deleted after it was read.
+var ErrVideoModified = errors.New("video was modified")
+
+const updateVideoQuery = `
 	UPDATE videos
 	SET
+		updated_at = ?,
 		title = ?,
 		description = ?,
+		visibility = ?,
 		thumbnail_url = ?,
+		thumbnail_srcset = ?,
 		video_url = ?,
+		hls_url = ?,
+		dash_url = ?,
+		sprite_vtt_url = ?,
+		sprite_sheet_urls = ?,
+		current_version = ?,
+		size_bytes = ?,
+		thumbnail_size_bytes = ?,
+		duration_seconds = ?,
+		width = ?,
+		height = ?,
+		aspect_ratio = ?,
+		video_codec = ?,
+		bitrate = ?,
+		frame_rate = ?,
+		rotation = ?,
+		audio_channels = ?,
+		container_format = ?,
 		user_id = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
-		query,
+func updateVideoArgs(video Video) []any {
+	return []any{
+		video.UpdatedAt,
 		video.Title,
 		video.Description,
+		video.Visibility,
 		&video.ThumbnailURL,
+		video.ThumbnailSrcset,
 		&video.VideoURL,
+		&video.HLSURL,
+		&video.DASHURL,
+		&video.SpriteVTTURL,
+		video.SpriteSheetURLs,
+		video.CurrentVersion,
+		video.SizeBytes,
+		video.ThumbnailSizeBytes,
+		video.DurationSeconds,
+		video.Width,
+		video.Height,
+		video.AspectRatio,
+		video.VideoCodec,
+		video.Bitrate,
+		video.FrameRate,
+		video.Rotation,
+		video.AudioChannels,
+		video.ContainerFormat,
 		video.UserID,
 		video.ID,
-	)
+	}
+}
+
+// UpdateVideo writes every field of video and bumps updated_at. The time is
+// set from Go rather than CURRENT_TIMESTAMP, which only has one-second
+// resolution, so that updated_at changes on every write.
+func (c Client) UpdateVideo(video Video) error {
+	video.UpdatedAt = time.Now().UTC()
+	_, err := c.db.Exec(updateVideoQuery, updateVideoArgs(video)...)
 	return err
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+// UpdateVideoIfUnmodified is UpdateVideo, but it fails with ErrVideoModified
+// unless the stored updated_at still equals video.UpdatedAt. It returns the
+// video with its new updated_at.
+func (c Client) UpdateVideoIfUnmodified(video Video) (Video, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	var updatedAt time.Time
+	err = tx.QueryRow("SELECT updated_at FROM videos WHERE id = ?", video.ID).Scan(&updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Video{}, ErrVideoModified
+	}
+	if err != nil {
+		return Video{}, err
+	}
+	if !updatedAt.Equal(video.UpdatedAt) {
+		return Video{}, ErrVideoModified
+	}
+
+	video.UpdatedAt = time.Now().UTC()
+	_, err = tx.Exec(updateVideoQuery, updateVideoArgs(video)...)
+	if err != nil {
+		return Video{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return Video{}, err
+	}
+	return video, nil
+}
+
+func (c Client) IncrementVideoViews(id uuid.UUID) error {
 	query := `
-	DELETE FROM videos
+	UPDATE videos
+	SET view_count = view_count + 1
 	WHERE id = ?
 	`
 	_, err := c.db.Exec(query, id)
 	return err
 }
+
+func (c Client) SetVideoProcessingStatus(id uuid.UUID, status string) error {
+	query := `
+	UPDATE videos
+	SET processing_status = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, status, id)
+	return err
+}
@@ -0,0 +1,77 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const exifOrientationTag = 0x0112
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 if the
+// file has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+		marker := data[offset+1]
+		// Start of scan: the metadata segments are all behind us.
+		if marker == 0xDA {
+			return 1
+		}
+		segmentLength := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		segmentStart := offset + 4
+		segmentEnd := offset + 2 + segmentLength
+		if segmentLength < 2 || segmentEnd > len(data) {
+			return 1
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[segmentStart:segmentEnd], []byte("Exif\x00\x00")) {
+			return tiffOrientation(data[segmentStart+6 : segmentEnd])
+		}
+		offset = segmentEnd
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	// Compare before converting, as a large offset overflows int on 32-bit
+	// platforms.
+	offset := order.Uint32(tiff[4:8])
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 1
+	}
+	ifdOffset := int(offset)
+	entries := int(order.Uint16(tiff[ifdOffset : ifdOffset+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) != exifOrientationTag {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
@@ -0,0 +1,52 @@
+package imageproc
+
+import "testing"
+
+func TestTiffOrientation(t *testing.T) {
+	// A little-endian TIFF header whose first IFD holds one orientation
+	// entry with the value 6.
+	littleEndian := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0,
+		1, 0,
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, 6, 0, 0, 0,
+	}
+	bigEndian := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		0, 1,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 3, 0, 0,
+	}
+	otherTag := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0,
+		1, 0,
+		0x10, 0x01, 2, 0, 4, 0, 0, 0, 6, 0, 0, 0,
+	}
+	outOfRange := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0,
+		1, 0,
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, 9, 0, 0, 0,
+	}
+
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{name: "little endian", tiff: littleEndian, want: 6},
+		{name: "big endian", tiff: bigEndian, want: 3},
+		{name: "no orientation tag", tiff: otherTag, want: 1},
+		{name: "orientation out of range", tiff: outOfRange, want: 1},
+		{name: "truncated entry", tiff: littleEndian[:15], want: 1},
+		{name: "IFD past the end", tiff: []byte{'I', 'I', 42, 0, 100, 0, 0, 0}, want: 1},
+		{name: "IFD offset overflows int32", tiff: []byte{'I', 'I', 42, 0, 0xFF, 0xFF, 0xFF, 0xFF}, want: 1},
+		{name: "unknown byte order", tiff: []byte{'X', 'X', 42, 0, 8, 0, 0, 0}, want: 1},
+		{name: "too short", tiff: []byte{'I', 'I'}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tiffOrientation(tt.tiff); got != tt.want {
+				t.Fatalf("tiffOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
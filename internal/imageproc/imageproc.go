@@ -0,0 +1,178 @@
+package imageproc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+const (
+	JPEGQuality = 82
+	WebPQuality = 80
+
+	// MaxPixels bounds the images Decode accepts. A small file can declare
+	// huge dimensions, and decoding allocates four bytes per pixel.
+	MaxPixels = 40_000_000
+)
+
+var ErrTooManyPixels = fmt.Errorf("image has more than %d pixels", MaxPixels)
+
+// Decode reads a JPEG or PNG image and applies its EXIF orientation, so the
+// returned image is upright. Images larger than MaxPixels are rejected
+// before they're decoded.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// orient applies an EXIF orientation (1-8) to img.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// Resize scales img to the given width, keeping its aspect ratio. It only
+// ever shrinks; narrower images are returned unchanged.
+func Resize(img image.Image, width int) image.Image {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= 0 || width >= srcW {
+		return img
+	}
+	height := max(1, srcH*width/srcW)
+	src := toRGBA(img)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Area averaging: every destination pixel is the mean of the source
+	// pixels it covers.
+	for dy := 0; dy < height; dy++ {
+		sy0 := dy * srcH / height
+		sy1 := max(sy0+1, (dy+1)*srcH/height)
+		for dx := 0; dx < width; dx++ {
+			sx0 := dx * srcW / width
+			sx1 := max(sx0+1, (dx+1)*srcW/width)
+			var r, g, b, a, n int
+			for sy := sy0; sy < sy1; sy++ {
+				i := src.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			di := dst.PixOffset(dx, dy)
+			dst.Pix[di] = uint8(r / n)
+			dst.Pix[di+1] = uint8(g / n)
+			dst.Pix[di+2] = uint8(b / n)
+			dst.Pix[di+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG re-encodes img without any of the source's metadata.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+}
+
+// EncodeWebP shells out to ffmpeg, as the standard library has no WebP
+// encoder.
+func EncodeWebP(ctx context.Context, w io.Writer, img image.Image) error {
+	var input bytes.Buffer
+	err := png.Encode(&input, img)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-v", "error",
+		"-f", "png_pipe",
+		"-i", "pipe:0",
+		"-c:v", "libwebp",
+		"-quality", fmt.Sprint(WebPQuality),
+		"-map_metadata", "-1",
+		"-f", "webp",
+		"pipe:1",
+	)
+	cmd.Stdin = &input
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("ffmpeg webp: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
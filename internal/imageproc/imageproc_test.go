@@ -0,0 +1,42 @@
+package imageproc
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// A 2x3 image with its top-left pixel marked, and where that pixel
+	// should end up once the image is upright.
+	tests := []struct {
+		orientation int
+		wantSize    image.Point
+		wantMarked  image.Point
+	}{
+		{orientation: 1, wantSize: image.Pt(2, 3), wantMarked: image.Pt(0, 0)},
+		{orientation: 2, wantSize: image.Pt(2, 3), wantMarked: image.Pt(1, 0)},
+		{orientation: 3, wantSize: image.Pt(2, 3), wantMarked: image.Pt(1, 2)},
+		{orientation: 4, wantSize: image.Pt(2, 3), wantMarked: image.Pt(0, 2)},
+		{orientation: 5, wantSize: image.Pt(3, 2), wantMarked: image.Pt(0, 0)},
+		{orientation: 6, wantSize: image.Pt(3, 2), wantMarked: image.Pt(2, 0)},
+		{orientation: 7, wantSize: image.Pt(3, 2), wantMarked: image.Pt(2, 1)},
+		{orientation: 8, wantSize: image.Pt(3, 2), wantMarked: image.Pt(0, 1)},
+		{orientation: 9, wantSize: image.Pt(2, 3), wantMarked: image.Pt(0, 0)},
+	}
+
+	marked := color.RGBA{R: 255, A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 3))
+	src.SetRGBA(0, 0, marked)
+
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		if size := got.Bounds().Size(); size != tt.wantSize {
+			t.Errorf("orient(%d) size = %v, want %v", tt.orientation, size, tt.wantSize)
+			continue
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.wantMarked.X, tt.wantMarked.Y)); c != marked {
+			t.Errorf("orient(%d) pixel at %v = %v, want %v", tt.orientation, tt.wantMarked, c, marked)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package mediaprobe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type Metadata struct {
+	ContainerFormat string
+	Duration        float64 // seconds
+	BitRate         int64   // bits per second
+	HasVideo        bool
+	Width           int // coded size, see DisplaySize
+	Height          int
+	VideoCodec      string
+	FrameRate       float64
+	Rotation        int // degrees clockwise, 0-359
+	HasAudio        bool
+	AudioCodec      string
+	AudioChannels   int
+}
+
+// DisplaySize returns the width and height the video is shown at once its
+// rotation is applied.
+func (m Metadata) DisplaySize() (int, int) {
+	if m.Rotation == 90 || m.Rotation == 270 {
+		return m.Height, m.Width
+	}
+	return m.Width, m.Height
+}
+
+type ffprobeOutput struct {
+	Streams []ffprobeStream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+type ffprobeStream struct {
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	RFrameRate   string `json:"r_frame_rate"`
+	BitRate      string `json:"bit_rate"`
+	Channels     int    `json:"channels"`
+	Disposition  struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+	Tags struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		SideDataType string  `json:"side_data_type"`
+		Rotation     float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+func Probe(ctx context.Context, filePath string) (Metadata, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		filePath,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return Metadata{}, fmt.Errorf("ffprobe: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parse(stdout.Bytes())
+}
+
+func parse(data []byte) (Metadata, error) {
+	var out ffprobeOutput
+	err := json.Unmarshal(data, &out)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	meta := Metadata{
+		ContainerFormat: out.Format.FormatName,
+		Duration:        parseFloat(out.Format.Duration),
+		BitRate:         parseInt(out.Format.BitRate),
+	}
+	for _, stream := range out.Streams {
+		switch stream.CodecType {
+		case "video":
+			// Cover art in MP4/MKV shows up as a single-frame video stream.
+			if meta.HasVideo || stream.Disposition.AttachedPic == 1 {
+				continue
+			}
+			meta.HasVideo = true
+			meta.Width = stream.Width
+			meta.Height = stream.Height
+			meta.VideoCodec = stream.CodecName
+			meta.FrameRate = parseRational(stream.AvgFrameRate)
+			if meta.FrameRate == 0 {
+				meta.FrameRate = parseRational(stream.RFrameRate)
+			}
+			meta.Rotation = streamRotation(stream)
+		case "audio":
+			if meta.HasAudio {
+				continue
+			}
+			meta.HasAudio = true
+			meta.AudioCodec = stream.CodecName
+			meta.AudioChannels = stream.Channels
+		}
+	}
+	return meta, nil
+}
+
+// streamRotation reads the display matrix side data written by newer ffmpeg
+// versions, falling back to the legacy rotate tag.
+func streamRotation(stream ffprobeStream) int {
+	for _, sideData := range stream.SideDataList {
+		if sideData.SideDataType == "Display Matrix" {
+			// The display matrix rotation is counter-clockwise.
+			return normalizeRotation(-int(sideData.Rotation))
+		}
+	}
+	if stream.Tags.Rotate != "" {
+		rotate, err := strconv.Atoi(stream.Tags.Rotate)
+		if err == nil {
+			return normalizeRotation(rotate)
+		}
+	}
+	return 0
+}
+
+func normalizeRotation(degrees int) int {
+	return ((degrees % 360) + 360) % 360
+}
+
+func parseRational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		return parseFloat(s)
+	}
+	n := parseFloat(num)
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func parseInt(s string) int64 {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return i
+}
@@ -0,0 +1,116 @@
+package mediaprobe
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Metadata
+	}{
+		{
+			name: "video and audio",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30000/1001"},
+					{"codec_type": "audio", "codec_name": "aac", "channels": 2}
+				],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.500000", "bit_rate": "4000000"}
+			}`,
+			want: Metadata{
+				ContainerFormat: "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:        12.5,
+				BitRate:         4000000,
+				HasVideo:        true,
+				Width:           1920,
+				Height:          1080,
+				VideoCodec:      "h264",
+				FrameRate:       30000.0 / 1001.0,
+				HasAudio:        true,
+				AudioCodec:      "aac",
+				AudioChannels:   2,
+			},
+		},
+		{
+			name: "display matrix rotation",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30/1",
+					 "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]}
+				],
+				"format": {}
+			}`,
+			want: Metadata{HasVideo: true, Width: 1920, Height: 1080, VideoCodec: "h264", FrameRate: 30, Rotation: 90},
+		},
+		{
+			name: "legacy rotate tag",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30/1",
+					 "tags": {"rotate": "270"}}
+				],
+				"format": {}
+			}`,
+			want: Metadata{HasVideo: true, Width: 1920, Height: 1080, VideoCodec: "h264", FrameRate: 30, Rotation: 270},
+		},
+		{
+			name: "frame rate falls back to r_frame_rate",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "vp9", "width": 640, "height": 360, "avg_frame_rate": "0/0", "r_frame_rate": "25/1"}
+				],
+				"format": {}
+			}`,
+			want: Metadata{HasVideo: true, Width: 640, Height: 360, VideoCodec: "vp9", FrameRate: 25},
+		},
+		{
+			name: "cover art is not video",
+			output: `{
+				"streams": [
+					{"codec_type": "audio", "codec_name": "mp3", "channels": 2},
+					{"codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600, "disposition": {"attached_pic": 1}}
+				],
+				"format": {"format_name": "mp3", "duration": "180.0"}
+			}`,
+			want: Metadata{ContainerFormat: "mp3", Duration: 180, HasAudio: true, AudioCodec: "mp3", AudioChannels: 2},
+		},
+		{
+			name:   "no streams",
+			output: `{"streams": [], "format": {"format_name": "mp3"}}`,
+			want:   Metadata{ContainerFormat: "mp3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplaySize(t *testing.T) {
+	tests := []struct {
+		rotation   int
+		wantWidth  int
+		wantHeight int
+	}{
+		{rotation: 0, wantWidth: 1920, wantHeight: 1080},
+		{rotation: 90, wantWidth: 1080, wantHeight: 1920},
+		{rotation: 180, wantWidth: 1920, wantHeight: 1080},
+		{rotation: 270, wantWidth: 1080, wantHeight: 1920},
+	}
+
+	for _, tt := range tests {
+		meta := Metadata{Width: 1920, Height: 1080, Rotation: tt.rotation}
+		width, height := meta.DisplaySize()
+		if width != tt.wantWidth || height != tt.wantHeight {
+			t.Errorf("DisplaySize() with rotation %d = %dx%d, want %dx%d", tt.rotation, width, height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStorage keeps objects on the local filesystem. It is intended for
+// development and tests. Presigned URLs are links to baseURL with an HMAC
+// that Handler checks; the key is generated at startup, so they don't
+// survive a restart.
+type LocalStorage struct {
+	root       string
+	baseURL    string
+	signingKey []byte
+}
+
+func NewLocalStorage(root, baseURL string) (*LocalStorage, error) {
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, err
+	}
+	signingKey := make([]byte, 32)
+	_, err = rand.Read(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStorage{
+		root:       root,
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/",
+		signingKey: signingKey,
+	}, nil
+}
+
+func (s *LocalStorage) objectPath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+key {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	objectPath, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(objectPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = io.Copy(tmpFile, body)
+	if err != nil {
+		return err
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), objectPath)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	objectPath, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(objectPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	objectPath, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(objectPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.Put(ctx, dstKey, src, "")
+}
+
+func (s *LocalStorage) Presign(ctx context.Context, key string, expireTime time.Duration) (string, error) {
+	_, err := s.objectPath(key)
+	if err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expireTime).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {s.signature(key, expires)},
+	}
+	return s.baseURL + key + "?" + query.Encode(), nil
+}
+
+func (s *LocalStorage) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStorage) validSignature(key string, query url.Values) bool {
+	expires := query.Get("expires")
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresUnix {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("signature")), []byte(s.signature(key, expires)))
+}
+
+// Handler serves objects at their keys, without directory listings. Keys
+// under signedPrefixes are only served through an unexpired presigned URL.
+func (s *LocalStorage) Handler(signedPrefixes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		objectPath, err := s.objectPath(key)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		for _, prefix := range signedPrefixes {
+			if strings.HasPrefix(key, prefix) && !s.validSignature(key, r.URL.Query()) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		file, err := os.Open(objectPath)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+	})
+}
+
+func (s *LocalStorage) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	objectPath, err := s.objectPath(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(objectPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ObjectInfo{}, ErrNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// Walk the deepest directory the prefix names and filter from there.
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dirPath, err := s.objectPath(prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		dir = dirPath
+	}
+
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		relPath, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         info.Size(),
+			ContentType:  mime.TypeByExtension(path.Ext(key)),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
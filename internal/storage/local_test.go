@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorageObjectPath(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewLocalStorage(root, "http://localhost:8091/storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "landscape/abc.mp4", want: filepath.Join(root, "landscape", "abc.mp4")},
+		{key: "private/thumbnails/id/a-320.jpg", want: filepath.Join(root, "private", "thumbnails", "id", "a-320.jpg")},
+		{key: "../outside", wantErr: true},
+		{key: "landscape/../../outside", wantErr: true},
+		{key: "landscape/../abc.mp4", wantErr: true},
+		{key: "/abs.mp4", wantErr: true},
+		{key: "landscape//abc.mp4", wantErr: true},
+		{key: "landscape/", wantErr: true},
+		{key: ".", wantErr: true},
+		{key: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := s.objectPath(tt.key)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("objectPath(%q) = %q, want an error", tt.key, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("objectPath(%q) error = %v", tt.key, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("objectPath(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLocalStorageHandler(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "http://localhost:8091/storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"landscape/a.mp4", "private/landscape/b.mp4"} {
+		err := s.Put(ctx, key, strings.NewReader("video"), "video/mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	signed, err := s.Presign(ctx, "private/landscape/b.mp4", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedQuery := strings.TrimPrefix(signed, "http://localhost:8091/storage/private/landscape/b.mp4")
+	expired, err := s.Presign(ctx, "private/landscape/b.mp4", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredQuery := strings.TrimPrefix(expired, "http://localhost:8091/storage/private/landscape/b.mp4")
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "public object", target: "/landscape/a.mp4", want: http.StatusOK},
+		{name: "directory", target: "/landscape/", want: http.StatusNotFound},
+		{name: "root", target: "/", want: http.StatusNotFound},
+		{name: "missing object", target: "/landscape/c.mp4", want: http.StatusNotFound},
+		{name: "unsigned private object", target: "/private/landscape/b.mp4", want: http.StatusForbidden},
+		{name: "signed private object", target: "/private/landscape/b.mp4" + signedQuery, want: http.StatusOK},
+		{name: "signature for another key", target: "/private/landscape/a.mp4" + signedQuery, want: http.StatusForbidden},
+		{name: "expired signature", target: "/private/landscape/b.mp4" + expiredQuery, want: http.StatusForbidden},
+		{name: "private directory", target: "/private/", want: http.StatusNotFound},
+	}
+
+	handler := s.Handler("private/")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d", tt.target, w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	maxCopyObjectSize = 5 << 30 // CopyObject rejects larger sources
+	copyPartSize      = 1 << 30
+)
+
+// Copy copies the object within the bucket without downloading it. Objects
+// too large for CopyObject are copied in parts.
+func (s *S3Storage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	info, err := s.Head(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	if info.Size > maxCopyObjectSize {
+		return s.copyMultipart(ctx, srcKey, dstKey, info)
+	}
+
+	_, err = s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(s.copySource(srcKey)),
+	})
+	return err
+}
+
+func (s *S3Storage) copyMultipart(ctx context.Context, srcKey, dstKey string, src ObjectInfo) error {
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(dstKey),
+		ContentType: aws.String(src.ContentType),
+	})
+	if err != nil {
+		return err
+	}
+	uploadID := created.UploadId
+
+	parts := []types.CompletedPart{}
+	for offset := int64(0); offset < src.Size; offset += copyPartSize {
+		partNumber := int32(len(parts) + 1)
+		end := min(offset+copyPartSize, src.Size) - 1
+		out, err := s.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(dstKey),
+			UploadId:        uploadID,
+			PartNumber:      aws.Int32(partNumber),
+			CopySource:      aws.String(s.copySource(srcKey)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			return errors.Join(fmt.Errorf("part %d: %w", partNumber, err), s.abortMultipart(dstKey, uploadID))
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:       out.CopyPartResult.ETag,
+			PartNumber: aws.Int32(partNumber),
+		})
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(dstKey),
+		UploadId: uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: parts,
+		},
+	})
+	if err != nil {
+		return errors.Join(err, s.abortMultipart(dstKey, uploadID))
+	}
+	return nil
+}
+
+// copySource is the URL-encoded bucket/key S3 expects as a copy source.
+func (s *S3Storage) copySource(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.bucket + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const minPartSize = 5 << 20 // S3 rejects non-final parts smaller than 5 MB
+
+type MultipartConfig struct {
+	Threshold   int64
+	PartSize    int64
+	Concurrency int
+	MaxRetries  int
+}
+
+func DefaultMultipartConfig() MultipartConfig {
+	return MultipartConfig{
+		Threshold:   100 << 20,
+		PartSize:    16 << 20,
+		Concurrency: 4,
+		MaxRetries:  3,
+	}
+}
+
+type statReaderAt interface {
+	io.ReaderAt
+	Stat() (fs.FileInfo, error)
+}
+
+// multipartSize reports whether body should be sent with a multipart upload
+// and, if so, how large it is. Only seekable files with a known size qualify.
+func (s *S3Storage) multipartSize(body io.Reader) (statReaderAt, int64, bool) {
+	file, ok := body.(statReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+	info, err := file.Stat()
+	if err != nil || info.Size() < s.multipart.Threshold {
+		return nil, 0, false
+	}
+	return file, info.Size(), true
+}
+
+func (s *S3Storage) putMultipart(ctx context.Context, key string, body io.ReaderAt, size int64, contentType string) error {
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return err
+	}
+	uploadID := created.UploadId
+
+	parts, err := s.uploadParts(ctx, key, uploadID, body, size)
+	if err != nil {
+		return errors.Join(err, s.abortMultipart(key, uploadID))
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: parts,
+		},
+	})
+	if err != nil {
+		// The stored parts are billed until the upload is aborted.
+		return errors.Join(err, s.abortMultipart(key, uploadID))
+	}
+	return nil
+}
+
+// abortMultipart discards the parts of an unfinished multipart upload. It
+// uses a fresh context so a cancelled request still cleans up the parts
+// that were already stored.
+func (s *S3Storage) abortMultipart(key string, uploadID *string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	return err
+}
+
+func (s *S3Storage) uploadParts(ctx context.Context, key string, uploadID *string, body io.ReaderAt, size int64) ([]types.CompletedPart, error) {
+	partSize := max(s.multipart.PartSize, minPartSize)
+	partCount := int((size + partSize - 1) / partSize)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	partNumbers := make(chan int32)
+	var (
+		mu       sync.Mutex
+		parts    []types.CompletedPart
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < max(s.multipart.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range partNumbers {
+				offset := int64(partNumber-1) * partSize
+				length := min(partSize, size-offset)
+				etag, err := s.uploadPartWithRetry(ctx, key, uploadID, partNumber, io.NewSectionReader(body, offset, length))
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("part %d: %w", partNumber, err)
+						cancel()
+					}
+				} else {
+					parts = append(parts, types.CompletedPart{
+						ETag:       etag,
+						PartNumber: aws.Int32(partNumber),
+					})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for partNumber := int32(1); partNumber <= int32(partCount); partNumber++ {
+		select {
+		case partNumbers <- partNumber:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(partNumbers)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.ToInt32(parts[i].PartNumber) < aws.ToInt32(parts[j].PartNumber)
+	})
+	return parts, nil
+}
+
+func (s *S3Storage) uploadPartWithRetry(ctx context.Context, key string, uploadID *string, partNumber int32, body *io.SectionReader) (*string, error) {
+	var err error
+	for attempt := 0; attempt <= s.multipart.MaxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<(attempt-1)) * 500 * time.Millisecond
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			_, err = body.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var out *s3.UploadPartOutput
+		out, err = s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(key),
+			UploadId:   uploadID,
+			PartNumber: aws.Int32(partNumber),
+			Body:       body,
+		})
+		if err == nil {
+			return out.ETag, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// faultyTransport fails the first failures[partNumber] UploadPart requests
+// for each part with a 500 and passes everything else through.
+type faultyTransport struct {
+	mu       sync.Mutex
+	failures map[string]int
+	attempts map[string]int
+}
+
+func (t *faultyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+	if req.Method == http.MethodPut && query.Has("uploadId") {
+		partNumber := query.Get("partNumber")
+		t.mu.Lock()
+		t.attempts[partNumber]++
+		fail := t.failures[partNumber] > 0
+		if fail {
+			t.failures[partNumber]--
+		}
+		t.mu.Unlock()
+		if fail {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Header:     http.Header{"Content-Type": []string{"application/xml"}},
+				Body:       io.NopCloser(strings.NewReader("<Error><Code>InternalError</Code><Message>injected</Message></Error>")),
+				Request:    req,
+			}, nil
+		}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestS3Storage connects to the S3-compatible endpoint in S3_ENDPOINT,
+// such as a local MinIO, and the bucket in S3_BUCKET. Credentials come from
+// the usual AWS environment variables. Without an endpoint, the test is
+// skipped so it never runs against a real account by accident.
+func newTestS3Storage(t *testing.T, transport *faultyTransport) (*S3Storage, *s3.Client) {
+	t.Helper()
+	endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := os.Getenv("S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("S3_ENDPOINT and S3_BUCKET aren't set")
+	}
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = true
+		o.HTTPClient = &http.Client{Transport: transport}
+		// Leave retrying to uploadPartWithRetry.
+		o.Retryer = aws.NopRetryer{}
+	})
+	s := NewS3Storage(client, bucket, MultipartConfig{
+		Threshold:   minPartSize,
+		PartSize:    minPartSize,
+		Concurrency: 2,
+		MaxRetries:  2,
+	})
+	return s, client
+}
+
+// writeTestFile writes three parts' worth of random data, the last one short.
+func writeTestFile(t *testing.T) (*os.File, []byte) {
+	t.Helper()
+	data := make([]byte, 2*minPartSize+1024)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.CreateTemp(t.TempDir(), "multipart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	_, err = file.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, data
+}
+
+func TestS3MultipartRetry(t *testing.T) {
+	transport := &faultyTransport{failures: map[string]int{"2": 1}, attempts: map[string]int{}}
+	s, _ := newTestS3Storage(t, transport)
+	file, data := writeTestFile(t)
+	ctx := context.Background()
+	key := "tests/multipart-retry-" + t.Name()
+	t.Cleanup(func() { s.Delete(context.Background(), key) })
+
+	err := s.Put(ctx, key, file, "application/octet-stream")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	for _, partNumber := range []string{"1", "2", "3"} {
+		want := 1
+		if partNumber == "2" {
+			want = 2
+		}
+		if got := transport.attempts[partNumber]; got != want {
+			t.Errorf("part %s was sent %d times, want %d", partNumber, got, want)
+		}
+	}
+
+	body, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	stored, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, data) {
+		t.Fatalf("stored object has %d bytes that don't match the %d uploaded", len(stored), len(data))
+	}
+}
+
+func TestS3MultipartAbort(t *testing.T) {
+	transport := &faultyTransport{failures: map[string]int{"2": 100}, attempts: map[string]int{}}
+	s, client := newTestS3Storage(t, transport)
+	file, _ := writeTestFile(t)
+	ctx := context.Background()
+	key := "tests/multipart-abort-" + t.Name()
+
+	err := s.Put(ctx, key, file, "application/octet-stream")
+	if err == nil {
+		s.Delete(ctx, key)
+		t.Fatal("Put() succeeded, want an error")
+	}
+	if got, want := transport.attempts["2"], s.multipart.MaxRetries+1; got != want {
+		t.Errorf("part 2 was sent %d times, want %d", got, want)
+	}
+
+	uploads, err := client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads.Uploads) != 0 {
+		t.Errorf("%d multipart uploads left for %s, want them aborted", len(uploads.Uploads), key)
+	}
+	_, err = s.Get(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Presign(ctx context.Context, key string, expireTime time.Duration) (string, error)
+	Head(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Copy copies the object at srcKey, along with its content type, to
+	// dstKey.
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+// DeletePrefix deletes every object whose key starts with prefix.
+func DeletePrefix(ctx context.Context, s Storage, prefix string) error {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		err := s.Delete(ctx, object.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,26 +5,42 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cfsign"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
-	s3Client         *s3.Client
+	db                   database.Client
+	jwtSecret            string
+	platform             string
+	filepathRoot         string
+	assetsRoot           string
+	uploadsRoot          string
+	s3Bucket             string
+	s3Region             string
+	s3CfDistribution     string
+	port                 string
+	storage              storage.Storage
+	objectBaseURL        string
+	publicURL            publicBaseURL
+	signedURLExpiry      time.Duration
+	playbackCookieExpiry time.Duration
+	cdnSigner            *cfsign.Signer
+	cdnCookieDomain      string
+	cdnSignClientIP      bool
+	dashEnabled          bool
+	versionRetention     int
+	trashRetention       time.Duration
+	uploadSessionExpiry  time.Duration
 }
 
 // type thumbnail struct {
@@ -32,8 +48,6 @@ type apiConfig struct {
 // 	mediaType string
 // }
 
-const baseWebsiteURL = "172.29.217.92"
-
 func main() {
 	godotenv.Load(".env")
 
@@ -67,19 +81,9 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is not set")
-	}
-
-	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
-		log.Fatal("S3_REGION environment variable is not set")
-	}
-
-	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	uploadsRoot := os.Getenv("UPLOADS_ROOT")
+	if uploadsRoot == "" {
+		log.Fatal("UPLOADS_ROOT environment variable is not set")
 	}
 
 	port := os.Getenv("PORT")
@@ -87,23 +91,181 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
-	s3Cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
+	publicBaseURLEnv := os.Getenv("PUBLIC_BASE_URL")
+	if publicBaseURLEnv == "" {
+		publicBaseURLEnv = "http://localhost:" + port
+	}
+	publicURL, err := newPublicBaseURL(publicBaseURLEnv, os.Getenv("TRUSTED_PROXIES"))
 	if err != nil {
-		log.Fatal("Couldn't configure AWS")
+		log.Fatalf("Invalid PUBLIC_BASE_URL or TRUSTED_PROXIES: %v", err)
+	}
+
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = "s3"
+	}
+
+	var s3Bucket, s3Region, s3CfDistribution, objectBaseURL string
+	var objectStorage storage.Storage
+	var cdnSigner *cfsign.Signer
+	switch storageBackend {
+	case "s3":
+		s3Bucket = os.Getenv("S3_BUCKET")
+		if s3Bucket == "" {
+			log.Fatal("S3_BUCKET environment variable is not set")
+		}
+
+		s3Region = os.Getenv("S3_REGION")
+		if s3Region == "" {
+			log.Fatal("S3_REGION environment variable is not set")
+		}
+
+		s3CfDistribution = os.Getenv("S3_CF_DISTRO")
+		if s3CfDistribution == "" {
+			log.Fatal("S3_CF_DISTRO environment variable is not set")
+		}
+
+		s3Cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
+		if err != nil {
+			log.Fatal("Couldn't configure AWS")
+		}
+		s3Client := s3.NewFromConfig(s3Cfg, func(o *s3.Options) {
+			// S3_ENDPOINT points the client at an S3-compatible stand-in
+			// such as MinIO for local testing.
+			if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+				o.BaseEndpoint = &endpoint
+				o.UsePathStyle = true
+			}
+		})
+
+		multipartConfig := storage.DefaultMultipartConfig()
+		if threshold := os.Getenv("S3_MULTIPART_THRESHOLD_MB"); threshold != "" {
+			thresholdMB, err := strconv.ParseInt(threshold, 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid S3_MULTIPART_THRESHOLD_MB: %v", err)
+			}
+			multipartConfig.Threshold = thresholdMB << 20
+		}
+		if concurrency := os.Getenv("S3_MULTIPART_CONCURRENCY"); concurrency != "" {
+			multipartConfig.Concurrency, err = strconv.Atoi(concurrency)
+			if err != nil {
+				log.Fatalf("Invalid S3_MULTIPART_CONCURRENCY: %v", err)
+			}
+		}
+		objectStorage = storage.NewS3Storage(s3Client, s3Bucket, multipartConfig)
+		objectBaseURL = s3CfDistribution
+
+		// With a CloudFront key pair, private content is signed against the
+		// distribution instead of presigned against the bucket.
+		cfKeyPairID := os.Getenv("CF_KEY_PAIR_ID")
+		cfPrivateKeyPath := os.Getenv("CF_PRIVATE_KEY_PATH")
+		if (cfKeyPairID == "") != (cfPrivateKeyPath == "") {
+			log.Fatal("CF_KEY_PAIR_ID and CF_PRIVATE_KEY_PATH must be set together")
+		}
+		if cfKeyPairID != "" {
+			cfPrivateKey, err := cfsign.LoadPrivateKey(cfPrivateKeyPath)
+			if err != nil {
+				log.Fatalf("Couldn't load CloudFront private key: %v", err)
+			}
+			cdnSigner = cfsign.NewSigner(cfKeyPairID, cfPrivateKey)
+		}
+	case "local":
+		localStorageRoot := os.Getenv("LOCAL_STORAGE_ROOT")
+		if localStorageRoot == "" {
+			log.Fatal("LOCAL_STORAGE_ROOT environment variable is not set")
+		}
+
+		// Stored relative and resolved against PUBLIC_BASE_URL on read.
+		objectBaseURL = "/storage/"
+		objectStorage, err = storage.NewLocalStorage(localStorageRoot, objectBaseURL)
+		if err != nil {
+			log.Fatalf("Couldn't create local storage: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q, must be 's3' or 'local'", storageBackend)
+	}
+
+	dashEnabled := false
+	if enableDASH := os.Getenv("ENABLE_DASH"); enableDASH != "" {
+		dashEnabled, err = strconv.ParseBool(enableDASH)
+		if err != nil {
+			log.Fatalf("Invalid ENABLE_DASH: %v", err)
+		}
+	}
+
+	signedURLExpiry := 5 * time.Minute
+	if expiry := os.Getenv("SIGNED_URL_EXPIRY"); expiry != "" {
+		signedURLExpiry, err = time.ParseDuration(expiry)
+		if err != nil {
+			log.Fatalf("Invalid SIGNED_URL_EXPIRY: %v", err)
+		}
+	}
+
+	// Playback cookies have to outlast a viewing session, since players keep
+	// fetching segments long after the signed manifest URL has expired.
+	playbackCookieExpiry := 4 * time.Hour
+	if expiry := os.Getenv("PLAYBACK_COOKIE_EXPIRY"); expiry != "" {
+		playbackCookieExpiry, err = time.ParseDuration(expiry)
+		if err != nil {
+			log.Fatalf("Invalid PLAYBACK_COOKIE_EXPIRY: %v", err)
+		}
+	}
+
+	cdnSignClientIP := false
+	if signClientIP := os.Getenv("CF_SIGN_CLIENT_IP"); signClientIP != "" {
+		cdnSignClientIP, err = strconv.ParseBool(signClientIP)
+		if err != nil {
+			log.Fatalf("Invalid CF_SIGN_CLIENT_IP: %v", err)
+		}
+	}
+
+	versionRetention := 3
+	if retention := os.Getenv("VIDEO_VERSION_RETENTION"); retention != "" {
+		versionRetention, err = strconv.Atoi(retention)
+		if err != nil || versionRetention < 0 {
+			log.Fatalf("Invalid VIDEO_VERSION_RETENTION: %q", retention)
+		}
+	}
+
+	trashRetention := 30 * 24 * time.Hour
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		trashRetention, err = time.ParseDuration(retention)
+		if err != nil || trashRetention < 0 {
+			log.Fatalf("Invalid TRASH_RETENTION: %q", retention)
+		}
+	}
+
+	uploadSessionExpiry := 24 * time.Hour
+	if expiry := os.Getenv("UPLOAD_SESSION_EXPIRY"); expiry != "" {
+		uploadSessionExpiry, err = time.ParseDuration(expiry)
+		if err != nil || uploadSessionExpiry <= 0 {
+			log.Fatalf("Invalid UPLOAD_SESSION_EXPIRY: %q", expiry)
+		}
 	}
-	s3Client := s3.NewFromConfig(s3Cfg)
 
 	cfg := apiConfig{
-		db:               db,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
-		s3Client:         s3Client,
+		db:                   db,
+		jwtSecret:            jwtSecret,
+		platform:             platform,
+		filepathRoot:         filepathRoot,
+		assetsRoot:           assetsRoot,
+		uploadsRoot:          uploadsRoot,
+		s3Bucket:             s3Bucket,
+		s3Region:             s3Region,
+		s3CfDistribution:     s3CfDistribution,
+		port:                 port,
+		storage:              objectStorage,
+		objectBaseURL:        objectBaseURL,
+		publicURL:            publicURL,
+		signedURLExpiry:      signedURLExpiry,
+		playbackCookieExpiry: playbackCookieExpiry,
+		cdnSigner:            cdnSigner,
+		cdnCookieDomain:      os.Getenv("CF_COOKIE_DOMAIN"),
+		cdnSignClientIP:      cdnSignClientIP,
+		dashEnabled:          dashEnabled,
+		versionRetention:     versionRetention,
+		trashRetention:       trashRetention,
+		uploadSessionExpiry:  uploadSessionExpiry,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -111,6 +273,63 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	err = os.MkdirAll(uploadsRoot, 0755)
+	if err != nil {
+		log.Fatalf("Couldn't create uploads directory: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		err = cfg.runCommand(os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = cfg.migrateObjectRefs()
+	if err != nil {
+		log.Fatalf("Couldn't migrate stored object URLs: %v", err)
+	}
+
+	videoWorkers := 2
+	if workers := os.Getenv("VIDEO_WORKERS"); workers != "" {
+		videoWorkers, err = strconv.Atoi(workers)
+		if err != nil {
+			log.Fatalf("Invalid VIDEO_WORKERS: %v", err)
+		}
+	}
+	err = cfg.startVideoWorkers(context.Background(), videoWorkers)
+	if err != nil {
+		log.Fatalf("Couldn't start video workers: %v", err)
+	}
+	go cfg.runStorageDeletionSweeper(context.Background())
+	go cfg.moveAllVideoObjects(context.Background())
+	go cfg.runTrashPurger(context.Background())
+	go cfg.runUploadSessionSweeper(context.Background())
+
+	// GC_INTERVAL enables a periodic garbage collection pass, which only
+	// reports orphans unless GC_DELETE is set.
+	if interval := os.Getenv("GC_INTERVAL"); interval != "" {
+		gcInterval, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid GC_INTERVAL: %v", err)
+		}
+		gcOpts := gcOptions{gracePeriod: defaultGCGracePeriod}
+		if grace := os.Getenv("GC_GRACE_PERIOD"); grace != "" {
+			gcOpts.gracePeriod, err = time.ParseDuration(grace)
+			if err != nil {
+				log.Fatalf("Invalid GC_GRACE_PERIOD: %v", err)
+			}
+		}
+		if deleteOrphans := os.Getenv("GC_DELETE"); deleteOrphans != "" {
+			gcOpts.delete, err = strconv.ParseBool(deleteOrphans)
+			if err != nil {
+				log.Fatalf("Invalid GC_DELETE: %v", err)
+			}
+		}
+		go cfg.runGarbageCollector(context.Background(), gcInterval, gcOpts)
+	}
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
@@ -118,18 +337,42 @@ func main() {
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
+	if localStorage, ok := objectStorage.(*storage.LocalStorage); ok {
+		// Raw uploads are never linked, so nothing can sign for them.
+		storageHandler := http.StripPrefix("/storage", localStorage.Handler(privateKeyPrefix, "raw/"))
+		mux.Handle("/storage/", storageHandler)
+	}
+
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("GET /api/usage", cfg.handlerUsage)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/sessions", cfg.handlerUploadSessionCreate)
+	mux.HandleFunc("GET /api/upload_sessions/{sessionID}", cfg.handlerUploadSessionGet)
+	mux.HandleFunc("PUT /api/upload_sessions/{sessionID}/chunks/{chunkIndex}", cfg.handlerUploadSessionPutChunk)
+	mux.HandleFunc("POST /api/upload_sessions/{sessionID}/complete", cfg.handlerUploadSessionComplete)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/feed", cfg.handlerFeed)
+	mux.HandleFunc("GET /api/search", cfg.handlerSearch)
+	mux.HandleFunc("GET /api/trash", cfg.handlerTrashGet)
+	mux.HandleFunc("POST /api/trash/{videoID}/restore", cfg.handlerTrashRestore)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/status", cfg.handlerVideoStatus)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("PUT /api/videos/{videoID}/visibility", cfg.handlerVideoVisibilityUpdate)
+	mux.HandleFunc("POST /api/videos/{videoID}/playback_cookies", cfg.handlerVideoPlaybackCookies)
+	mux.HandleFunc("GET /api/videos/{videoID}/versions", cfg.handlerVideoVersionsGet)
+	mux.HandleFunc("POST /api/videos/{videoID}/versions/{version}/rollback", cfg.handlerVideoVersionRollback)
+	mux.HandleFunc("GET /api/videos/{videoID}/viewers", cfg.handlerVideoViewersGet)
+	mux.HandleFunc("POST /api/videos/{videoID}/viewers", cfg.handlerVideoViewerAdd)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/viewers/{userID}", cfg.handlerVideoViewerRemove)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
@@ -138,6 +381,6 @@ func main() {
 		Handler: mux,
 	}
 
-	log.Printf("Serving on: http://%s:%s/app/\n", baseWebsiteURL, port)
+	log.Printf("Serving on: %s/app/\n", publicURL)
 	log.Fatal(srv.ListenAndServe())
 }
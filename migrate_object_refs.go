@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// migrateObjectRefs replaces the object URLs stored by older versions with
+// refs. It has to run while objectBaseURL still matches them, so it runs on
+// every start.
+func (cfg *apiConfig) migrateObjectRefs() error {
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return err
+	}
+	migrated := 0
+	for _, video := range videos {
+		video, changed := cfg.storeObjectRefs(video)
+		if !changed {
+			continue
+		}
+		err := cfg.db.UpdateVideo(video)
+		if err != nil {
+			return fmt.Errorf("video %s: %w", video.ID, err)
+		}
+		migrated++
+	}
+
+	versions, err := cfg.db.GetAllVideoVersions()
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		video, changed := cfg.storeObjectRefs(version.Apply(database.Video{}))
+		if !changed {
+			continue
+		}
+		err := cfg.db.UpdateVideoVersionURLs(withVideoURLs(version, video))
+		if err != nil {
+			return fmt.Errorf("version %d of video %s: %w", version.Version, version.VideoID, err)
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		log.Printf("Replaced stored object URLs with refs in %d videos and versions", migrated)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// migrateThumbnails moves thumbnails written to the assets directory by older
+// versions into object storage and rewrites the stored URLs.
+func (cfg *apiConfig) migrateThumbnails(args []string) error {
+	flags := flag.NewFlagSet("migrate-thumbnails", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be moved without changing anything")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, video := range videos {
+		assetFiles := []string{}
+		rewrite := func(rawURL string) (string, error) {
+			assetFile, ok := cfg.localAssetPath(rawURL)
+			if !ok {
+				return rawURL, nil
+			}
+			key := thumbnailKeyPrefix(video.ID) + path.Base(assetFile)
+			if *dryRun {
+				log.Printf("Would move %s to %s", assetFile, key)
+				return rawURL, nil
+			}
+			err := cfg.putAssetFile(ctx, assetFile, key)
+			if err != nil {
+				return "", err
+			}
+			assetFiles = append(assetFiles, assetFile)
+			return cfg.objectRef(key), nil
+		}
+
+		updated, err := rewriteThumbnailURLs(video, rewrite)
+		if err != nil {
+			return fmt.Errorf("video %s: %w", video.ID, err)
+		}
+		if len(assetFiles) == 0 {
+			continue
+		}
+
+		err = cfg.db.UpdateVideo(updated)
+		if err != nil {
+			return fmt.Errorf("video %s: %w", video.ID, err)
+		}
+		for _, assetFile := range assetFiles {
+			err := os.Remove(assetFile)
+			if err != nil {
+				log.Printf("Couldn't remove %s: %v", assetFile, err)
+			}
+		}
+		migrated++
+		log.Printf("Migrated thumbnails for video %s", video.ID)
+	}
+
+	log.Printf("Migrated thumbnails for %d of %d videos", migrated, len(videos))
+	return nil
+}
+
+// rewriteThumbnailURLs applies rewrite to the thumbnail URL and every srcset
+// candidate of the video.
+func rewriteThumbnailURLs(video database.Video, rewrite func(string) (string, error)) (database.Video, error) {
+	if video.ThumbnailURL != nil {
+		thumbnailURL, err := rewrite(*video.ThumbnailURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video.ThumbnailURL = &thumbnailURL
+	}
+
+	if video.ThumbnailSrcset != nil {
+		srcset := database.StringMap{}
+		for mimeType, set := range video.ThumbnailSrcset {
+			candidates := strings.Split(set, ", ")
+			for i, candidate := range candidates {
+				candidateURL, descriptor, _ := strings.Cut(candidate, " ")
+				rewritten, err := rewrite(candidateURL)
+				if err != nil {
+					return database.Video{}, err
+				}
+				candidates[i] = strings.TrimSpace(rewritten + " " + descriptor)
+			}
+			srcset[mimeType] = strings.Join(candidates, ", ")
+		}
+		video.ThumbnailSrcset = srcset
+	}
+	return video, nil
+}
+
+// isAssetURL reports whether the URL points into the assets directory rather
+// than object storage.
+func isAssetURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && strings.HasPrefix(parsed.Path, "/assets/")
+}
+
+// localAssetPath maps a URL served from /assets/ to the file behind it.
+func (cfg *apiConfig) localAssetPath(rawURL string) (string, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	fileName, ok := strings.CutPrefix(parsed.Path, "/assets/")
+	if !ok || fileName == "" || strings.Contains(fileName, "/") {
+		return "", false
+	}
+	assetFile := filepath.Join(cfg.assetsRoot, fileName)
+	if _, err := os.Stat(assetFile); err != nil {
+		return "", false
+	}
+	return assetFile, true
+}
+
+func (cfg *apiConfig) putAssetFile(ctx context.Context, assetFile, key string) error {
+	file, err := os.Open(assetFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(assetFile))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return cfg.storage.Put(ctx, key, file, contentType)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// privateKeyPrefix holds the objects of private videos. With S3, the
+// distribution must refuse unsigned requests for it (see the README), or
+// private videos are readable by anyone who learns a URL.
+const privateKeyPrefix = "private/"
+
+var errVisibilityChanged = errors.New("video visibility changed")
+
+// visibilityKey returns where key belongs for a video with the given
+// visibility.
+func visibilityKey(key, visibility string) string {
+	key = strings.TrimPrefix(key, privateKeyPrefix)
+	if visibility == database.VideoVisibilityPrivate {
+		return privateKeyPrefix + key
+	}
+	return key
+}
+
+// moveVideoObjects moves the objects of the video and its versions under
+// privateKeyPrefix when it's private, and out of it otherwise, and points
+// the stored refs at the new keys. Run it after anything that can leave
+// objects in the wrong place: visibility changes and new uploads.
+func (cfg *apiConfig) moveVideoObjects(ctx context.Context, videoID uuid.UUID) error {
+	video, err := cfg.db.GetVideoIncludingTrashed(videoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		return nil
+	}
+	versions, err := cfg.db.GetVideoVersions(videoID)
+	if err != nil {
+		return err
+	}
+	visibility := video.Visibility
+
+	targets := cfg.thumbnailTargets(video)
+	targets = cfg.appendUploadTargets(targets, video)
+	for _, version := range versions {
+		targets = cfg.appendUploadTargets(targets, version.Apply(database.Video{}))
+	}
+
+	// Only the keys copied here are deleted afterwards, so objects written
+	// to the old location meanwhile aren't lost.
+	moved := map[string]bool{}
+	copies := []storageTarget{}
+	for _, target := range targets {
+		if visibilityKey(target.key, visibility) == target.key {
+			continue
+		}
+		keys := []string{target.key}
+		if target.isPrefix {
+			objects, err := cfg.storage.List(ctx, target.key)
+			if err != nil {
+				cfg.scheduleStorageDeletions(ctx, videoID, copies)
+				return err
+			}
+			keys = keys[:0]
+			for _, object := range objects {
+				keys = append(keys, object.Key)
+			}
+		}
+		for _, key := range keys {
+			if moved[key] {
+				continue
+			}
+			dst := visibilityKey(key, visibility)
+			err := cfg.storage.Copy(ctx, key, dst)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				cfg.scheduleStorageDeletions(ctx, videoID, copies)
+				return fmt.Errorf("couldn't copy %s: %w", key, err)
+			}
+			moved[key] = true
+			copies = append(copies, storageTarget{key: dst})
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+
+	rekey := func(stored string) (string, error) {
+		key, ok := cfg.objectKey(stored)
+		if !ok || !moved[key] {
+			return stored, nil
+		}
+		return cfg.objectRef(visibilityKey(key, visibility)), nil
+	}
+	_, err = cfg.mergeVideoUpdate(videoID, func(video database.Video) (database.Video, error) {
+		if video.Visibility != visibility {
+			return database.Video{}, errVisibilityChanged
+		}
+		return rewriteVideoURLs(video, rekey)
+	})
+	if errors.Is(err, errVisibilityChanged) || errors.Is(err, errVideoDeleted) {
+		// Whatever changed the video takes care of its objects.
+		cfg.scheduleStorageDeletions(ctx, videoID, copies)
+		return nil
+	}
+	if err != nil {
+		cfg.scheduleStorageDeletions(ctx, videoID, copies)
+		return err
+	}
+
+	for _, version := range versions {
+		rekeyed, err := rewriteVideoURLs(version.Apply(database.Video{}), rekey)
+		if err != nil {
+			return err
+		}
+		err = cfg.db.UpdateVideoVersionURLs(withVideoURLs(version, rekeyed))
+		if err != nil {
+			return fmt.Errorf("couldn't update version %d: %w", version.Version, err)
+		}
+	}
+
+	originals := []storageTarget{}
+	for key := range moved {
+		originals = append(originals, storageTarget{key: key})
+	}
+	cfg.scheduleStorageDeletions(ctx, videoID, originals)
+	return nil
+}
+
+// moveVideoObjectsForResponse moves the video's objects and returns the
+// updated video.
+func (cfg *apiConfig) moveVideoObjectsForResponse(ctx context.Context, videoID uuid.UUID) (database.Video, error) {
+	err := cfg.moveVideoObjects(ctx, videoID)
+	if err != nil {
+		return database.Video{}, err
+	}
+	return cfg.db.GetVideoIncludingTrashed(videoID)
+}
+
+// moveAllVideoObjects moves the objects of every video to where its
+// visibility says they belong. It picks up videos made private before
+// privateKeyPrefix existed and moves that failed.
+func (cfg *apiConfig) moveAllVideoObjects(ctx context.Context) {
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		log.Printf("Couldn't retrieve videos to move their objects: %v", err)
+		return
+	}
+	for _, video := range videos {
+		err := cfg.moveVideoObjects(ctx, video.ID)
+		if err != nil {
+			log.Printf("Couldn't move objects of video %s: %v", video.ID, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// legacyWebsiteHost is the address older versions baked into stored
+// thumbnail and local storage URLs.
+const legacyWebsiteHost = "172.29.217.92"
+
+// publicBaseURL builds the absolute URLs handed to clients. URLs that point
+// back at this server are stored relative ("/storage/...") and resolved
+// against it per request, so changing hosts doesn't orphan stored data.
+type publicBaseURL struct {
+	base           *url.URL
+	trustedProxies []*net.IPNet
+}
+
+func newPublicBaseURL(rawBase, trustedProxies string) (publicBaseURL, error) {
+	base, err := url.Parse(rawBase)
+	if err != nil {
+		return publicBaseURL{}, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return publicBaseURL{}, fmt.Errorf("public base URL %q must use http or https", rawBase)
+	}
+	if base.Host == "" {
+		return publicBaseURL{}, fmt.Errorf("public base URL %q has no host", rawBase)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawQuery = ""
+	base.Fragment = ""
+
+	p := publicBaseURL{base: base}
+	for _, proxy := range strings.Split(trustedProxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return publicBaseURL{}, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		p.trustedProxies = append(p.trustedProxies, network)
+	}
+	return p, nil
+}
+
+func (p publicBaseURL) String() string {
+	return p.base.String()
+}
+
+// forRequest returns the base URL, honoring X-Forwarded-Proto and
+// X-Forwarded-Host when the request came through a trusted proxy.
+func (p publicBaseURL) forRequest(r *http.Request) *url.URL {
+	base := *p.base
+	if r == nil || !p.isTrustedProxy(r.RemoteAddr) {
+		return &base
+	}
+	if proto := firstHeaderValue(r.Header, "X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		base.Scheme = proto
+	}
+	if host := firstHeaderValue(r.Header, "X-Forwarded-Host"); host != "" {
+		base.Host = host
+	}
+	return &base
+}
+
+// clientIP returns the address of the client. When the request came through
+// a trusted proxy, it's the rightmost X-Forwarded-For entry that isn't a
+// trusted proxy itself. Entries left of it come from the client and can be
+// forged.
+func (p publicBaseURL) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !p.isTrustedProxy(r.RemoteAddr) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		host = ip.String()
+		if !p.isTrustedProxy(host) {
+			break
+		}
+	}
+	return host
+}
+
+func (p publicBaseURL) isTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve turns a stored URL into one the client can use. Relative URLs are
+// joined with the public base URL and legacy absolute URLs pointing at the
+// old hardcoded host are rewritten the same way; anything else, such as CDN
+// URLs, is returned unchanged.
+func (p publicBaseURL) resolve(r *http.Request, stored string) string {
+	if strings.HasPrefix(stored, "/") && !strings.HasPrefix(stored, "//") {
+		return p.forRequest(r).String() + stored
+	}
+	parsed, err := url.Parse(stored)
+	if err == nil && parsed.Hostname() == legacyWebsiteHost {
+		return p.forRequest(r).String() + parsed.RequestURI()
+	}
+	return stored
+}
+
+func firstHeaderValue(header http.Header, key string) string {
+	value, _, _ := strings.Cut(header.Get(key), ",")
+	return strings.TrimSpace(value)
+}
+
+// resolveVideoURLs rewrites every stored URL on the video for the client.
+func (cfg *apiConfig) resolveVideoURLs(r *http.Request, video database.Video) database.Video {
+	video, _ = rewriteVideoURLs(video, func(stored string) (string, error) {
+		return cfg.publicURL.resolve(r, stored), nil
+	})
+	return video
+}
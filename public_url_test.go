@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	p, err := newPublicBaseURL("https://tubely.example.com", "10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor []string
+		want          string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted peer's header is ignored", remoteAddr: "203.0.113.7:5000", xForwardedFor: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:5000", xForwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "forged entries are skipped", remoteAddr: "10.0.0.2:5000", xForwardedFor: []string{"1.2.3.4, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.0.0.2:5000", xForwardedFor: []string{"198.51.100.1, 192.0.2.1", "10.0.0.3"}, want: "198.51.100.1"},
+		{name: "garbage stops the walk", remoteAddr: "10.0.0.2:5000", xForwardedFor: []string{"198.51.100.1, nonsense, 10.0.0.3"}, want: "10.0.0.3"},
+		{name: "no header", remoteAddr: "10.0.0.2:5000", want: "10.0.0.2"},
+		{name: "IPv6", remoteAddr: "[2001:db8::1]:5000", want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+			for _, value := range tt.xForwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := p.clientIP(r); got != tt.want {
+				t.Fatalf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
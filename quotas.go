@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) userQuota(userID uuid.UUID) (database.Quota, database.Usage, error) {
+	quota, err := cfg.db.GetUserQuota(userID)
+	if err != nil {
+		return database.Quota{}, database.Usage{}, err
+	}
+	usage, err := cfg.db.GetUserUsage(userID)
+	if err != nil {
+		return database.Quota{}, database.Usage{}, err
+	}
+	return quota, usage, nil
+}
+
+// checkUploadQuota rejects a file of size bytes that is larger than the
+// plan allows or doesn't fit in the user's remaining storage. freed is what
+// the upload replaces, such as a previous thumbnail.
+func checkUploadQuota(quota database.Quota, usage database.Usage, size, freed int64) error {
+	if size > quota.MaxFileBytes {
+		return &uploadRejectedError{
+			status:  http.StatusRequestEntityTooLarge,
+			message: fmt.Sprintf("File is larger than the %d byte limit", quota.MaxFileBytes),
+		}
+	}
+	if usage.TotalBytes-freed+size > quota.MaxTotalBytes {
+		return &uploadRejectedError{
+			status:  http.StatusRequestEntityTooLarge,
+			message: fmt.Sprintf("Upload would exceed your %d byte storage quota", quota.MaxTotalBytes),
+		}
+	}
+	return nil
+}
+
+func checkDurationQuota(quota database.Quota, durationSeconds float64) error {
+	if durationSeconds > quota.MaxDurationSeconds {
+		limit := time.Duration(quota.MaxDurationSeconds * float64(time.Second))
+		return &uploadRejectedError{
+			status:  http.StatusUnprocessableEntity,
+			message: fmt.Sprintf("Video is longer than the %s limit", limit),
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerUsage(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Limits database.Quota `json:"limits"`
+		Usage  database.Usage `json:"usage"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	quota, usage, err := cfg.userQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve usage", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Limits: quota, Usage: usage})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	spriteFrameWidth   = 160
+	spriteColumns      = 10
+	spriteRows         = 10
+	spriteMaxFrames    = 300
+	spriteMinInterval  = 2.0 // seconds
+	spriteVTTFileName  = "sprites.vtt"
+	spriteFileTemplate = "sprite_%03d.jpg"
+)
+
+type spriteSheets struct {
+	Dir        string
+	SheetNames []string
+}
+
+// generateSprites samples frames from the video, tiles them into sprite sheet
+// images and writes a WebVTT file mapping each time range to its tile. The
+// caller removes Dir.
+func generateSprites(ctx context.Context, filePath string, width, height int, duration float64) (spriteSheets, error) {
+	if duration <= 0 || width <= 0 || height <= 0 {
+		return spriteSheets{}, fmt.Errorf("invalid video dimensions %dx%d or duration %g", width, height, duration)
+	}
+
+	interval := max(spriteMinInterval, math.Ceil(duration/spriteMaxFrames))
+	frameCount := int(math.Ceil(duration / interval))
+	frameHeight := spriteFrameWidth * height / width
+	frameHeight -= frameHeight % 2
+
+	outputDir, err := os.MkdirTemp("", "tubely-sprites")
+	if err != nil {
+		return spriteSheets{}, err
+	}
+
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-i", filePath,
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", interval, spriteFrameWidth, frameHeight, spriteColumns, spriteRows),
+		"-q:v", "4",
+		filepath.Join(outputDir, spriteFileTemplate),
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.RemoveAll(outputDir)
+		return spriteSheets{}, fmt.Errorf("ffmpeg sprites: %w: %s", err, lastLine(output))
+	}
+
+	framesPerSheet := spriteColumns * spriteRows
+	sheetCount := (frameCount + framesPerSheet - 1) / framesPerSheet
+	sheets := spriteSheets{Dir: outputDir}
+	for i := 1; i <= sheetCount; i++ {
+		sheetName := fmt.Sprintf(spriteFileTemplate, i)
+		if _, err := os.Stat(filepath.Join(outputDir, sheetName)); err != nil {
+			// The sampled frame count can round down by one frame.
+			break
+		}
+		sheets.SheetNames = append(sheets.SheetNames, sheetName)
+	}
+
+	vtt := spriteVTT(frameCount, interval, duration, spriteFrameWidth, frameHeight, len(sheets.SheetNames))
+	err = os.WriteFile(filepath.Join(outputDir, spriteVTTFileName), []byte(vtt), 0644)
+	if err != nil {
+		os.RemoveAll(outputDir)
+		return spriteSheets{}, err
+	}
+	return sheets, nil
+}
+
+// spriteVTT builds WebVTT cues that point at tiles with media fragment
+// (#xywh=) coordinates, relative to the VTT file's location.
+func spriteVTT(frameCount int, interval, duration float64, frameWidth, frameHeight, sheetCount int) string {
+	framesPerSheet := spriteColumns * spriteRows
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for i := 0; i < frameCount; i++ {
+		sheet := i / framesPerSheet
+		if sheet >= sheetCount {
+			break
+		}
+		tile := i % framesPerSheet
+		start := float64(i) * interval
+		end := min(start+interval, duration)
+		fmt.Fprintf(&vtt, "\n%s --> %s\n", vttTimestamp(start), vttTimestamp(end))
+		fmt.Fprintf(
+			&vtt,
+			spriteFileTemplate+"#xywh=%d,%d,%d,%d\n",
+			sheet+1,
+			(tile%spriteColumns)*frameWidth,
+			(tile/spriteColumns)*frameHeight,
+			frameWidth,
+			frameHeight,
+		)
+	}
+	return vtt.String()
+}
+
+func vttTimestamp(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	secs := d / time.Second
+	d -= secs * time.Second
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, secs, d/time.Millisecond)
+}
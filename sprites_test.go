@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpriteVTT(t *testing.T) {
+	got := spriteVTT(3, 2, 5.5, 160, 90, 1)
+	want := `WEBVTT
+
+00:00:00.000 --> 00:00:02.000
+sprite_001.jpg#xywh=0,0,160,90
+
+00:00:02.000 --> 00:00:04.000
+sprite_001.jpg#xywh=160,0,160,90
+
+00:00:04.000 --> 00:00:05.500
+sprite_001.jpg#xywh=320,0,160,90
+`
+	if got != want {
+		t.Fatalf("spriteVTT() = %q, want %q", got, want)
+	}
+}
+
+func TestSpriteVTTSheets(t *testing.T) {
+	tests := []struct {
+		name       string
+		frameCount int
+		sheetCount int
+		wantCues   int
+		wantLast   string
+	}{
+		{name: "second row", frameCount: 11, sheetCount: 1, wantCues: 11, wantLast: "sprite_001.jpg#xywh=0,90,160,90"},
+		{name: "second sheet", frameCount: 101, sheetCount: 2, wantCues: 101, wantLast: "sprite_002.jpg#xywh=0,0,160,90"},
+		{name: "missing sheet", frameCount: 101, sheetCount: 1, wantCues: 100, wantLast: "sprite_001.jpg#xywh=1440,810,160,90"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vtt := spriteVTT(tt.frameCount, 2, float64(tt.frameCount)*2, 160, 90, tt.sheetCount)
+			lines := strings.Split(strings.TrimSpace(vtt), "\n")
+			if cues := strings.Count(vtt, " --> "); cues != tt.wantCues {
+				t.Errorf("spriteVTT() has %d cues, want %d", cues, tt.wantCues)
+			}
+			if last := lines[len(lines)-1]; last != tt.wantLast {
+				t.Errorf("last cue points at %q, want %q", last, tt.wantLast)
+			}
+		})
+	}
+}
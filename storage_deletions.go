@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	storageDeletionBaseBackoff   = time.Minute
+	storageDeletionMaxBackoff    = time.Hour
+	storageDeletionSweepInterval = time.Minute
+	storageDeletionBatchSize     = 100
+)
+
+type storageTarget struct {
+	key      string
+	isPrefix bool
+}
+
+// videoStorageTargets lists everything stored for the video and its
+// versions: thumbnails, raw uploads, and each version's renditions.
+func (cfg *apiConfig) videoStorageTargets(video database.Video, versions []database.VideoVersion) []storageTarget {
+	targets := []storageTarget{
+		{key: thumbnailKeyPrefix(video.ID), isPrefix: true},
+		{key: privateKeyPrefix + thumbnailKeyPrefix(video.ID), isPrefix: true},
+		{key: rawKeyPrefix(video.ID), isPrefix: true},
+	}
+	targets = cfg.appendUploadTargets(targets, video)
+	for _, version := range versions {
+		targets = cfg.appendUploadTargets(targets, version.Apply(database.Video{}))
+	}
+	return targets
+}
+
+// appendUploadTargets adds the MP4 and the renditions, sprites and
+// manifests under its base key, plus any other object the video's URLs
+// point at.
+func (cfg *apiConfig) appendUploadTargets(targets []storageTarget, video database.Video) []storageTarget {
+	if video.VideoURL != nil {
+		if videoKey, ok := cfg.objectKey(*video.VideoURL); ok {
+			baseKey := strings.TrimSuffix(videoKey, ".mp4")
+			targets = append(targets,
+				storageTarget{key: videoKey},
+				storageTarget{key: baseKey + "/", isPrefix: true},
+			)
+		}
+	}
+
+	rewriteVideoURLs(video, func(stored string) (string, error) {
+		key, ok := cfg.objectKey(stored)
+		if ok && !coveredByTargets(targets, key) {
+			targets = append(targets, storageTarget{key: key})
+		}
+		return stored, nil
+	})
+	return targets
+}
+
+// thumbnailTargets lists every stored variant of the video's thumbnail.
+func (cfg *apiConfig) thumbnailTargets(video database.Video) []storageTarget {
+	targets := []storageTarget{}
+	rewriteThumbnailURLs(video, func(stored string) (string, error) {
+		key, ok := cfg.objectKey(stored)
+		if ok && !coveredByTargets(targets, key) {
+			targets = append(targets, storageTarget{key: key})
+		}
+		return stored, nil
+	})
+	return targets
+}
+
+func coveredByTargets(targets []storageTarget, key string) bool {
+	for _, target := range targets {
+		if target.key == key || (target.isPrefix && strings.HasPrefix(key, target.key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteVideoStorage removes every stored artifact of a deleted video.
+// Each target is recorded before it's attempted, so anything that fails
+// here is finished by the sweeper.
+func (cfg *apiConfig) deleteVideoStorage(ctx context.Context, video database.Video, versions []database.VideoVersion) {
+	if video.ThumbnailURL != nil {
+		if assetFile, ok := cfg.localAssetPath(*video.ThumbnailURL); ok {
+			err := os.Remove(assetFile)
+			if err != nil {
+				log.Printf("Couldn't remove %s: %v", assetFile, err)
+			}
+		}
+	}
+
+	cfg.scheduleStorageDeletions(ctx, video.ID, cfg.videoStorageTargets(video, versions))
+}
+
+func (cfg *apiConfig) scheduleStorageDeletions(ctx context.Context, videoID uuid.UUID, targets []storageTarget) {
+	deletions := []database.StorageDeletion{}
+	for _, target := range targets {
+		deletion, err := cfg.db.CreateStorageDeletion(videoID, target.key, target.isPrefix)
+		if err != nil {
+			log.Printf("Couldn't schedule deletion of %s for video %s: %v", target.key, videoID, err)
+			continue
+		}
+		deletions = append(deletions, deletion)
+	}
+	for _, deletion := range deletions {
+		cfg.runStorageDeletion(ctx, deletion)
+	}
+}
+
+func (cfg *apiConfig) runStorageDeletion(ctx context.Context, deletion database.StorageDeletion) {
+	var err error
+	if deletion.IsPrefix {
+		err = storage.DeletePrefix(ctx, cfg.storage, deletion.Key)
+	} else {
+		err = cfg.storage.Delete(ctx, deletion.Key)
+	}
+	if err != nil {
+		log.Printf("Couldn't delete %s for video %s (attempt %d): %v", deletion.Key, deletion.VideoID, deletion.Attempts+1, err)
+		backoff := min(storageDeletionBaseBackoff<<min(deletion.Attempts, 10), storageDeletionMaxBackoff)
+		err = cfg.db.RetryStorageDeletion(deletion.ID, err.Error(), time.Now().Add(backoff))
+		if err != nil {
+			log.Printf("Couldn't reschedule deletion %s: %v", deletion.ID, err)
+		}
+		return
+	}
+
+	err = cfg.db.DeleteStorageDeletion(deletion.ID)
+	if err != nil {
+		log.Printf("Couldn't clear deletion %s: %v", deletion.ID, err)
+	}
+}
+
+// runStorageDeletionSweeper retries failed deletions until they succeed.
+func (cfg *apiConfig) runStorageDeletionSweeper(ctx context.Context) {
+	for {
+		deletions, err := cfg.db.GetDueStorageDeletions(storageDeletionBatchSize)
+		if err != nil {
+			log.Printf("Couldn't retrieve pending storage deletions: %v", err)
+		}
+		for _, deletion := range deletions {
+			cfg.runStorageDeletion(ctx, deletion)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(storageDeletionSweepInterval):
+		}
+	}
+}
+
+func rawKeyPrefix(videoID uuid.UUID) string {
+	return fmt.Sprintf("raw/%s/", videoID)
+}
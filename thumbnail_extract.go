@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+const (
+	thumbnailSceneThreshold = 0.3
+	thumbnailSearchWindow   = 5.0 // seconds
+	blackPixelLuma          = 32
+	blackFrameRatio         = 0.98
+)
+
+// thumbnailCandidates are the fractions of the duration to search, in order
+// of preference.
+var thumbnailCandidates = []float64{0.1, 0.2, 0.3, 0.5, 0.0}
+
+var errNoThumbnailFrame = errors.New("no non-black frame found")
+
+// extractThumbnail grabs a representative JPEG frame from the video and
+// returns the path of a temporary file. The caller removes the file.
+func extractThumbnail(ctx context.Context, filePath string, duration float64) (string, error) {
+	for _, fraction := range thumbnailCandidates {
+		start := duration * fraction
+		window := min(thumbnailSearchWindow, duration-start)
+		if window <= 0 {
+			window = thumbnailSearchWindow
+		}
+
+		framePath, err := grabFrame(ctx, filePath, start, window)
+		if err != nil {
+			return "", err
+		}
+		if framePath == "" {
+			continue
+		}
+
+		black, err := isBlackFrame(framePath)
+		if err != nil || black {
+			os.Remove(framePath)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		return framePath, nil
+	}
+	return "", errNoThumbnailFrame
+}
+
+// grabFrame prefers the first scene change in the window and falls back to
+// ffmpeg's thumbnail filter, which picks the most representative frame. It
+// returns an empty path if neither produced a frame.
+func grabFrame(ctx context.Context, filePath string, start, window float64) (string, error) {
+	filters := []string{
+		fmt.Sprintf("select='gt(scene,%g)'", thumbnailSceneThreshold),
+		"thumbnail",
+	}
+	for _, filter := range filters {
+		tmpFile, err := os.CreateTemp("", "tubely-thumbnail-*.jpg")
+		if err != nil {
+			return "", err
+		}
+		tmpFile.Close()
+
+		cmd := exec.CommandContext(
+			ctx,
+			"ffmpeg",
+			"-y",
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+			"-t", strconv.FormatFloat(window, 'f', 3, 64),
+			"-i", filePath,
+			"-vf", filter,
+			"-vsync", "vfr",
+			"-frames:v", "1",
+			"-q:v", "2",
+			tmpFile.Name(),
+		)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			os.Remove(tmpFile.Name())
+			return "", fmt.Errorf("ffmpeg thumbnail: %w: %s", err, lastLine(output))
+		}
+
+		info, err := os.Stat(tmpFile.Name())
+		if err == nil && info.Size() > 0 {
+			return tmpFile.Name(), nil
+		}
+		os.Remove(tmpFile.Name())
+	}
+	return "", nil
+}
+
+func isBlackFrame(framePath string) (bool, error) {
+	file, err := os.Open(framePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	img, err := jpeg.Decode(file)
+	if err != nil {
+		return false, err
+	}
+	return isMostlyBlack(img), nil
+}
+
+func isMostlyBlack(img image.Image) bool {
+	bounds := img.Bounds()
+	step := max(1, min(bounds.Dx(), bounds.Dy())/100)
+	var total, dark int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			// Rec. 601 luma on 8-bit values.
+			luma := (299*(r>>8) + 587*(g>>8) + 114*(b>>8)) / 1000
+			if luma < blackPixelLuma {
+				dark++
+			}
+			total++
+		}
+	}
+	return total > 0 && float64(dark)/float64(total) >= blackFrameRatio
+}
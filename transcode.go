@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type rendition struct {
+	Name         string
+	Height       int
+	VideoBitrate int // kbps
+	AudioBitrate int // kbps
+}
+
+var hlsLadder = []rendition{
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+const (
+	hlsSegmentSeconds  = 6
+	dashSegmentSeconds = 4
+)
+
+// ladderForSource returns the renditions that don't upscale the source.
+// Heights refer to the short side so portrait videos get the same ladder.
+func ladderForSource(width, height int) []rendition {
+	shortSide := min(width, height)
+	ladder := []rendition{}
+	for _, r := range hlsLadder {
+		if r.Height <= shortSide {
+			ladder = append(ladder, r)
+		}
+	}
+	if len(ladder) == 0 {
+		smallest := hlsLadder[len(hlsLadder)-1]
+		smallest.Height = shortSide - shortSide%2
+		smallest.Name = fmt.Sprintf("%dp", smallest.Height)
+		ladder = append(ladder, smallest)
+	}
+	return ladder
+}
+
+// outputSize scales the source so its short side matches r.Height, keeping
+// both dimensions even as libx264 requires.
+func (r rendition) outputSize(width, height int) (int, int) {
+	if width >= height {
+		w := width * r.Height / height
+		return w - w%2, r.Height
+	}
+	h := height * r.Height / width
+	return r.Height, h - h%2
+}
+
+// transcodeToHLS writes an HLS ladder with a master.m3u8 playlist into a new
+// temporary directory and returns its path. The caller removes the directory.
+func transcodeToHLS(ctx context.Context, filePath string, width, height int) (string, error) {
+	outputDir, err := os.MkdirTemp("", "tubely-hls")
+	if err != nil {
+		return "", err
+	}
+
+	ladder := ladderForSource(width, height)
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range ladder {
+		outWidth, outHeight := r.outputSize(width, height)
+		renditionDir := filepath.Join(outputDir, r.Name)
+		err := os.Mkdir(renditionDir, 0755)
+		if err != nil {
+			os.RemoveAll(outputDir)
+			return "", err
+		}
+
+		cmd := exec.CommandContext(
+			ctx,
+			"ffmpeg",
+			"-i", filePath,
+			"-map", "0:v:0",
+			"-map", "0:a:0?",
+			"-vf", fmt.Sprintf("scale=%d:%d", outWidth, outHeight),
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-profile:v", "main",
+			"-b:v", fmt.Sprintf("%dk", r.VideoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			"-bufsize", fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentSeconds),
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", r.AudioBitrate),
+			"-ac", "2",
+			"-f", "hls",
+			"-hls_time", fmt.Sprint(hlsSegmentSeconds),
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(renditionDir, "segment_%04d.ts"),
+			filepath.Join(renditionDir, "index.m3u8"),
+		)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			os.RemoveAll(outputDir)
+			return "", fmt.Errorf("ffmpeg %s rendition: %w: %s", r.Name, err, lastLine(output))
+		}
+
+		bandwidth := (r.VideoBitrate + r.AudioBitrate) * 1000
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n", bandwidth, outWidth, outHeight)
+		fmt.Fprintf(&master, "%s/index.m3u8\n", r.Name)
+	}
+
+	err = os.WriteFile(filepath.Join(outputDir, "master.m3u8"), []byte(master.String()), 0644)
+	if err != nil {
+		os.RemoveAll(outputDir)
+		return "", err
+	}
+	return outputDir, nil
+}
+
+// transcodeToDASH writes a DASH manifest.mpd with fragmented MP4 segments for
+// the same ladder as HLS into a new temporary directory and returns its path.
+// The caller removes the directory.
+func transcodeToDASH(ctx context.Context, filePath string, width, height int, hasAudio bool) (string, error) {
+	outputDir, err := os.MkdirTemp("", "tubely-dash")
+	if err != nil {
+		return "", err
+	}
+
+	ladder := ladderForSource(width, height)
+	args := []string{"-i", filePath}
+	for range ladder {
+		args = append(args, "-map", "0:v:0")
+	}
+	if hasAudio {
+		args = append(args, "-map", "0:a:0")
+	}
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", "main",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", dashSegmentSeconds),
+	)
+	for i, r := range ladder {
+		outWidth, outHeight := r.outputSize(width, height)
+		args = append(args,
+			fmt.Sprintf("-s:v:%d", i), fmt.Sprintf("%dx%d", outWidth, outHeight),
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+		)
+	}
+	adaptationSets := "id=0,streams=v"
+	if hasAudio {
+		args = append(args,
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", ladder[0].AudioBitrate),
+			"-ac", "2",
+		)
+		adaptationSets += " id=1,streams=a"
+	}
+	args = append(args,
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-seg_duration", fmt.Sprint(dashSegmentSeconds),
+		"-adaptation_sets", adaptationSets,
+		"-f", "dash",
+		filepath.Join(outputDir, "manifest.mpd"),
+	)
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		os.RemoveAll(outputDir)
+		return "", fmt.Errorf("ffmpeg dash: %w: %s", err, lastLine(output))
+	}
+	return outputDir, nil
+}
+
+// uploadDir stores every file below dir under keyPrefix, preserving the
+// relative layout so playlists can reference their segments.
+func (cfg *apiConfig) uploadDir(ctx context.Context, dir, keyPrefix string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return cfg.storage.Put(ctx, keyPrefix+filepath.ToSlash(relPath), file, contentTypeForFile(path))
+	})
+}
+
+func contentTypeForFile(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".mp4":
+		return "video/mp4"
+	case ".mpd":
+		return "application/dash+xml"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".vtt":
+		return "text/vtt"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	}
+	return "application/octet-stream"
+}
+
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return lines[len(lines)-1]
+}
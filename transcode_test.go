@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLadderForSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		want   []string
+	}{
+		{name: "4K", width: 3840, height: 2160, want: []string{"1080p", "720p", "480p", "360p"}},
+		{name: "1080p", width: 1920, height: 1080, want: []string{"1080p", "720p", "480p", "360p"}},
+		{name: "720p", width: 1280, height: 720, want: []string{"720p", "480p", "360p"}},
+		{name: "portrait 720p", width: 720, height: 1280, want: []string{"720p", "480p", "360p"}},
+		{name: "between rungs", width: 1000, height: 600, want: []string{"480p", "360p"}},
+		{name: "smaller than every rung", width: 426, height: 241, want: []string{"240p"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := []string{}
+			for _, r := range ladderForSource(tt.width, tt.height) {
+				names = append(names, r.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Fatalf("ladderForSource(%d, %d) = %v, want %v", tt.width, tt.height, names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	videoJobMaxAttempts  = 5
+	videoJobBaseBackoff  = 30 * time.Second
+	videoJobMaxBackoff   = 30 * time.Minute
+	videoJobPollInterval = 2 * time.Second
+)
+
+// enqueueVideoJob stores the raw upload and queues it for processing, so the
+// bytes survive a failed transcode or a restart.
+func (cfg *apiConfig) enqueueVideoJob(ctx context.Context, video database.Video, rawFile *os.File, mimeType string) (database.Video, error) {
+	_, err := rawFile.Seek(0, io.SeekStart)
+	if err != nil {
+		return database.Video{}, err
+	}
+	info, err := rawFile.Stat()
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	randomFilename, err := generateRandomFilename()
+	if err != nil {
+		return database.Video{}, fmt.Errorf("unable to generate filename: %w", err)
+	}
+	rawKey := rawKeyPrefix(video.ID) + randomFilename
+	err = cfg.storage.Put(ctx, rawKey, rawFile, mimeType)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("unable to store raw upload: %w", err)
+	}
+
+	_, err = cfg.db.CreateVideoJob(video.ID, rawKey, info.Size())
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't create processing job: %w", err)
+	}
+	err = cfg.db.SetVideoProcessingStatus(video.ID, database.VideoJobStatusQueued)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't update processing status: %w", err)
+	}
+	return cfg.db.GetVideo(video.ID)
+}
+
+func (cfg *apiConfig) startVideoWorkers(ctx context.Context, workers int) error {
+	err := cfg.db.RequeueProcessingVideoJobs()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < workers; i++ {
+		go cfg.runVideoWorker(ctx)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) runVideoWorker(ctx context.Context) {
+	for {
+		job, ok, err := cfg.db.ClaimVideoJob()
+		if err != nil {
+			log.Printf("Couldn't claim video job: %v", err)
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(videoJobPollInterval):
+			}
+			continue
+		}
+
+		err = cfg.runVideoJob(ctx, job)
+		if err != nil {
+			cfg.handleVideoJobError(job, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) runVideoJob(ctx context.Context, job database.VideoJob) error {
+	err := cfg.db.SetVideoProcessingStatus(job.VideoID, database.VideoJobStatusProcessing)
+	if err != nil {
+		return err
+	}
+
+	rawFile, err := cfg.downloadObject(ctx, job.RawKey)
+	if err != nil {
+		return fmt.Errorf("couldn't download raw upload: %w", err)
+	}
+	defer os.Remove(rawFile)
+
+	_, err = cfg.processVideo(ctx, job.VideoID, rawFile)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.db.CompleteVideoJob(job.ID)
+	if err != nil {
+		return err
+	}
+	err = cfg.db.SetVideoProcessingStatus(job.VideoID, database.VideoJobStatusReady)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.storage.Delete(ctx, job.RawKey)
+	if err != nil {
+		log.Printf("Couldn't delete raw upload %s: %v", job.RawKey, err)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handleVideoJobError(job database.VideoJob, jobErr error) {
+	log.Printf("Video job %s for video %s failed (attempt %d): %v", job.ID, job.VideoID, job.Attempts, jobErr)
+
+	if job.Attempts >= videoJobMaxAttempts {
+		err := cfg.db.FailVideoJob(job.ID, jobErr.Error())
+		if err != nil {
+			log.Printf("Couldn't mark video job %s failed: %v", job.ID, err)
+		}
+		err = cfg.db.SetVideoProcessingStatus(job.VideoID, database.VideoJobStatusFailed)
+		if err != nil {
+			log.Printf("Couldn't update processing status for video %s: %v", job.VideoID, err)
+		}
+		return
+	}
+
+	backoff := min(videoJobBaseBackoff<<(job.Attempts-1), videoJobMaxBackoff)
+	err := cfg.db.RetryVideoJob(job.ID, jobErr.Error(), time.Now().Add(backoff))
+	if err != nil {
+		log.Printf("Couldn't requeue video job %s: %v", job.ID, err)
+	}
+	err = cfg.db.SetVideoProcessingStatus(job.VideoID, database.VideoJobStatusQueued)
+	if err != nil {
+		log.Printf("Couldn't update processing status for video %s: %v", job.VideoID, err)
+	}
+}
+
+// downloadObject copies an object to a temporary file and returns its path.
+// The caller is responsible for removing the file.
+func (cfg *apiConfig) downloadObject(ctx context.Context, key string) (string, error) {
+	body, err := cfg.storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	tmpFile, err := os.CreateTemp("", "tubely-object")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+
+	_, err = io.Copy(tmpFile, body)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
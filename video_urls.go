@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cfsign"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) objectURL(key string) string {
+	return cfg.objectBaseURL + key
+}
+
+// objectRef is how videos store their objects: the bucket and key, with no
+// host. Public videos resolve it against the current objectBaseURL on every
+// read and private ones sign it, so changing the CDN doesn't orphan stored
+// data.
+func (cfg *apiConfig) objectRef(key string) string {
+	bucket := cfg.s3Bucket
+	if bucket == "" {
+		bucket = "local"
+	}
+	return bucket + "," + key
+}
+
+// objectKey returns the storage key behind a stored object URL or ref.
+func (cfg *apiConfig) objectKey(stored string) (string, bool) {
+	if !strings.Contains(stored, "://") {
+		if _, key, ok := strings.Cut(stored, ","); ok && key != "" {
+			return key, true
+		}
+	}
+	key, ok := strings.CutPrefix(stored, cfg.objectBaseURL)
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+func isObjectRef(stored string) bool {
+	return !strings.Contains(stored, "://") && strings.Contains(stored, ",")
+}
+
+// rewriteVideoURLs applies rewrite to every URL stored on the video.
+func rewriteVideoURLs(video database.Video, rewrite func(string) (string, error)) (database.Video, error) {
+	video, err := rewriteThumbnailURLs(video, rewrite)
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	for _, field := range []**string{&video.VideoURL, &video.HLSURL, &video.DASHURL, &video.SpriteVTTURL} {
+		if *field == nil {
+			continue
+		}
+		rewritten, err := rewrite(**field)
+		if err != nil {
+			return database.Video{}, err
+		}
+		*field = &rewritten
+	}
+
+	if video.SpriteSheetURLs != nil {
+		sheets := make(database.StringList, len(video.SpriteSheetURLs))
+		for i, sheet := range video.SpriteSheetURLs {
+			sheets[i], err = rewrite(sheet)
+			if err != nil {
+				return database.Video{}, err
+			}
+		}
+		video.SpriteSheetURLs = sheets
+	}
+	return video, nil
+}
+
+// storeObjectRefs replaces stored object URLs, written by older versions or
+// before objectBaseURL changed, with refs. URLs that don't point into object
+// storage are left alone. It reports whether anything changed.
+func (cfg *apiConfig) storeObjectRefs(video database.Video) (database.Video, bool) {
+	changed := false
+	video, _ = rewriteVideoURLs(video, func(stored string) (string, error) {
+		key, ok := cfg.objectKey(stored)
+		if !ok || isObjectRef(stored) {
+			return stored, nil
+		}
+		changed = true
+		return cfg.objectRef(key), nil
+	})
+	return video, changed
+}
+
+// dbVideoToPublicVideo replaces the refs stored on a video with URLs under
+// objectBaseURL.
+func (cfg *apiConfig) dbVideoToPublicVideo(video database.Video) database.Video {
+	video, _ = rewriteVideoURLs(video, func(stored string) (string, error) {
+		if !isObjectRef(stored) {
+			return stored, nil
+		}
+		key, _ := cfg.objectKey(stored)
+		return cfg.objectURL(key), nil
+	})
+	return video
+}
+
+// dbVideoToSignedVideo replaces the refs stored on a private video with
+// URLs that expire after signedURLExpiry. They're CloudFront signed URLs
+// when a key pair is configured and presigned storage URLs otherwise.
+func (cfg *apiConfig) dbVideoToSignedVideo(r *http.Request, video database.Video) (database.Video, error) {
+	expires := time.Now().Add(cfg.signedURLExpiry)
+	return rewriteVideoURLs(video, func(stored string) (string, error) {
+		if !isObjectRef(stored) {
+			return stored, nil
+		}
+		key, _ := cfg.objectKey(stored)
+		if cfg.cdnSigner != nil {
+			return cfg.cdnSigner.SignURL(cfg.objectURL(key), cfg.cdnPolicy(r, cfg.objectURL(key), expires))
+		}
+		return cfg.storage.Presign(r.Context(), key, cfg.signedURLExpiry)
+	})
+}
+
+func (cfg *apiConfig) cdnPolicy(r *http.Request, resource string, expires time.Time) cfsign.Policy {
+	policy := cfsign.Policy{Resource: resource, Expires: expires}
+	if cfg.cdnSignClientIP {
+		ip := net.ParseIP(cfg.publicURL.clientIP(r))
+		if ip.To4() != nil {
+			policy.IPRange = ip.String() + "/32"
+		} else if ip != nil {
+			policy.IPRange = ip.String() + "/128"
+		}
+	}
+	return policy
+}
+
+// videoForResponse turns a stored video into what the client receives. Only
+// call it for users allowed to watch the video.
+func (cfg *apiConfig) videoForResponse(r *http.Request, video database.Video) (database.Video, error) {
+	if video.Visibility == database.VideoVisibilityPrivate {
+		signed, err := cfg.dbVideoToSignedVideo(r, video)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video = signed
+	} else {
+		video = cfg.dbVideoToPublicVideo(video)
+	}
+	return cfg.resolveVideoURLs(r, video), nil
+}
+
+func (cfg *apiConfig) respondWithVideo(w http.ResponseWriter, r *http.Request, code int, video database.Video) {
+	video, err := cfg.videoForResponse(r, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, code, video)
+}
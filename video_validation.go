@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mediaprobe"
+)
+
+// uploadRejectedError carries the status code an upload should be rejected
+// with, whether it failed validation or doesn't fit the user's quota.
+type uploadRejectedError struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *uploadRejectedError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s: %v", e.message, e.err)
+	}
+	return e.message
+}
+
+func (e *uploadRejectedError) Unwrap() error {
+	return e.err
+}
+
+// validateVideoUpload checks the magic bytes of the uploaded file and then
+// asks ffprobe and ffmpeg to confirm it holds a decodable video stream. It
+// returns the sniffed MIME type and the probed metadata.
+func validateVideoUpload(ctx context.Context, file *os.File) (string, mediaprobe.Metadata, error) {
+	header := make([]byte, 512)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", mediaprobe.Metadata{}, err
+	}
+
+	mimeType, ok := sniffVideoContainer(header[:n])
+	if !ok {
+		return "", mediaprobe.Metadata{}, &uploadRejectedError{
+			status:  http.StatusUnsupportedMediaType,
+			message: "Unsupported file type. Upload an MP4, MOV, MKV or WebM video",
+		}
+	}
+
+	media, err := mediaprobe.Probe(ctx, file.Name())
+	if err != nil {
+		return "", mediaprobe.Metadata{}, &uploadRejectedError{
+			status:  http.StatusUnprocessableEntity,
+			message: "Couldn't read the video container",
+			err:     err,
+		}
+	}
+	if !media.HasVideo {
+		return "", mediaprobe.Metadata{}, &uploadRejectedError{
+			status:  http.StatusUnprocessableEntity,
+			message: "File doesn't contain a video stream",
+		}
+	}
+
+	err = decodeFirstFrame(ctx, file.Name())
+	if err != nil {
+		return "", mediaprobe.Metadata{}, &uploadRejectedError{
+			status:  http.StatusUnprocessableEntity,
+			message: fmt.Sprintf("Couldn't decode the %s video stream", media.VideoCodec),
+			err:     err,
+		}
+	}
+	return mimeType, media, nil
+}
+
+// sniffVideoContainer recognises ISO BMFF (MP4/MOV) and Matroska (MKV/WebM)
+// files from their first bytes.
+func sniffVideoContainer(header []byte) (string, bool) {
+	if len(header) >= 12 {
+		boxType := string(header[4:8])
+		if boxType == "ftyp" {
+			if string(header[8:12]) == "qt  " {
+				return "video/quicktime", true
+			}
+			return "video/mp4", true
+		}
+		// Older QuickTime files can start with these atoms instead of ftyp.
+		switch boxType {
+		case "moov", "mdat", "wide", "free", "skip", "pnot":
+			return "video/quicktime", true
+		}
+	}
+	if bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+		if bytes.Contains(header, []byte("webm")) {
+			return "video/webm", true
+		}
+		return "video/x-matroska", true
+	}
+	return "", false
+}
+
+func decodeFirstFrame(ctx context.Context, filePath string) error {
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-v", "error",
+		"-i", filePath,
+		"-map", "0:v:0",
+		"-frames:v", "1",
+		"-f", "null",
+		"-",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, lastLine(output))
+	}
+	return nil
+}
+
+// respondWithUploadError reports rejected uploads with their own status code
+// and anything else as a server error.
+func respondWithUploadError(w http.ResponseWriter, err error) {
+	var rejectedErr *uploadRejectedError
+	if errors.As(err, &rejectedErr) {
+		respondWithError(w, rejectedErr.status, rejectedErr.message, err)
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, "Couldn't validate video", err)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestSniffVideoContainer(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+		ok     bool
+	}{
+		{name: "mp4", header: []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), want: "video/mp4", ok: true},
+		{name: "mov", header: []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), want: "video/quicktime", ok: true},
+		{name: "old quicktime", header: []byte("\x00\x00\x00\x08wide\x00\x00\x00\x00"), want: "video/quicktime", ok: true},
+		{name: "webm", header: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), want: "video/webm", ok: true},
+		{name: "mkv", header: []byte("\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska"), want: "video/x-matroska", ok: true},
+		{name: "png", header: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")},
+		{name: "text", header: []byte("hello, this is not a video")},
+		{name: "short", header: []byte("\x00\x00\x00")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sniffVideoContainer(tt.header)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("sniffVideoContainer() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+var errVersionNotFound = errors.New("video version not found")
+
+// withVideoURLs returns the version with the stored URLs of video.
+func withVideoURLs(version database.VideoVersion, video database.Video) database.VideoVersion {
+	version.VideoURL = video.VideoURL
+	version.HLSURL = video.HLSURL
+	version.DASHURL = video.DASHURL
+	version.SpriteVTTURL = video.SpriteVTTURL
+	version.SpriteSheetURLs = video.SpriteSheetURLs
+	return version
+}
+
+// purgeVideoVersions deletes all but the newest versionRetention previous
+// versions of the video, along with their stored renditions. The current
+// version is always kept.
+func (cfg *apiConfig) purgeVideoVersions(ctx context.Context, video database.Video) {
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		log.Printf("Couldn't retrieve versions of video %s: %v", video.ID, err)
+		return
+	}
+
+	kept := 0
+	for _, version := range versions {
+		if video.CurrentVersion != nil && version.Version == *video.CurrentVersion {
+			continue
+		}
+		if kept < cfg.versionRetention {
+			kept++
+			continue
+		}
+
+		err := cfg.db.DeleteVideoVersion(version.ID)
+		if err != nil {
+			log.Printf("Couldn't delete version %d of video %s: %v", version.Version, video.ID, err)
+			continue
+		}
+		cfg.scheduleStorageDeletions(ctx, video.ID, cfg.appendUploadTargets(nil, version.Apply(database.Video{})))
+	}
+}
+
+func (cfg *apiConfig) handlerVideoVersionsGet(w http.ResponseWriter, r *http.Request) {
+	type versionResponse struct {
+		Version   int       `json:"version"`
+		CreatedAt time.Time `json:"created_at"`
+		Current   bool      `json:"current"`
+		database.MediaInfo
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video versions", err)
+		return
+	}
+
+	resp := []versionResponse{}
+	for _, version := range versions {
+		resp = append(resp, versionResponse{
+			Version:   version.Version,
+			CreatedAt: version.CreatedAt,
+			Current:   video.CurrentVersion != nil && *video.CurrentVersion == version.Version,
+			MediaInfo: version.MediaInfo,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerVideoVersionRollback(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid version", err)
+		return
+	}
+	version, err := cfg.db.GetVideoVersion(video.ID, versionNumber)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video version", err)
+		return
+	}
+	if version.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Version not found", nil)
+		return
+	}
+
+	// The version is read again on every attempt, since moving the video's
+	// objects rewrites its URLs and retention may purge it meanwhile.
+	video, err = cfg.mergeVideoUpdate(video.ID, func(video database.Video) (database.Video, error) {
+		version, err := cfg.db.GetVideoVersion(video.ID, versionNumber)
+		if err != nil {
+			return database.Video{}, err
+		}
+		if version.VideoURL == nil {
+			return database.Video{}, errVersionNotFound
+		}
+		video, _ = cfg.storeObjectRefs(version.Apply(video))
+		return video, nil
+	})
+	if errors.Is(err, errVideoDeleted) || errors.Is(err, errVersionNotFound) {
+		respondWithError(w, http.StatusNotFound, "Version not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	cfg.respondWithVideo(w, r, http.StatusOK, video)
+}